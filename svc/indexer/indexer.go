@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/search"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// indexer follows the Model's change feed and (re)indexes every changed issue
+// in the Search service.
+type indexer struct {
+	l      log.Logger
+	model  spb.ModelClient
+	search spb.SearchClient
+
+	// checkpoint is the path of the file in which the change feed cursor of
+	// the last indexed change is stored, together with the ID of the index
+	// it was indexed into. If empty, no checkpoint is kept.
+	checkpoint string
+}
+
+// readCheckpoint returns the last stored change feed cursor and the ID of the
+// index that the changes up to it were indexed into. Both are empty if no
+// checkpoint has been stored yet. Checkpoints stored before index IDs were
+// introduced have an empty index ID.
+func (i *indexer) readCheckpoint() (cursor, indexID string, err error) {
+	if i.checkpoint == "" {
+		return "", "", nil
+	}
+	data, err := ioutil.ReadFile(i.checkpoint)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	cursor = strings.TrimSpace(lines[0])
+	if len(lines) > 1 {
+		indexID = strings.TrimSpace(lines[1])
+	}
+	return cursor, indexID, nil
+}
+
+// writeCheckpoint atomically stores a change feed cursor and the ID of the
+// index that the changes up to it were indexed into.
+func (i *indexer) writeCheckpoint(cursor, indexID string) error {
+	if i.checkpoint == "" {
+		return nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(i.checkpoint), ".checkpoint")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(cursor + "\n" + indexID + "\n"); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), i.checkpoint)
+}
+
+// follow indexes all changes after the stored checkpoint, then keeps
+// indexing changes as they happen, reconnecting to the Model on errors. If
+// the Search index has been rebuilt since the checkpoint was stored, all
+// changes are indexed again. It returns when ctx is canceled.
+func (i *indexer) follow(ctx context.Context) error {
+	for {
+		err := i.followOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		i.l.Error("following changes failed, retrying", "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// followOnce indexes changes from the stored checkpoint until an error
+// occurs.
+func (i *indexer) followOnce(ctx context.Context) error {
+	cursor, checkpointID, err := i.readCheckpoint()
+	if err != nil {
+		return fmt.Errorf("could not read checkpoint: %w", err)
+	}
+	indexID, err := i.indexID(ctx)
+	if err != nil {
+		return err
+	}
+	if checkpointID != indexID {
+		i.l.Warn("search index changed since checkpoint, reindexing everything", "checkpoint", checkpointID, "index", indexID)
+		cursor = ""
+	}
+	return i.indexChanges(ctx, cursor, indexID, true)
+}
+
+// backfill reindexes all issues ever changed, ignoring the stored checkpoint.
+// Once done, the checkpoint is set to the last change, so that a subsequent
+// follow resumes from there.
+func (i *indexer) backfill(ctx context.Context) error {
+	indexID, err := i.indexID(ctx)
+	if err != nil {
+		return err
+	}
+	return i.indexChanges(ctx, "", indexID, false)
+}
+
+// indexID returns the current ID of the Search index.
+func (i *indexer) indexID(ctx context.Context) (string, error) {
+	res, err := i.search.GetIndexInfo(ctx, &spb.GetIndexInfoRequest{})
+	if err != nil {
+		return "", fmt.Errorf("GetIndexInfo: %w", err)
+	}
+	return res.IndexId, nil
+}
+
+// indexChanges indexes issues from all changes after a given cursor into the
+// Search index with a given ID, failing if the index ID changes. If follow is
+// set, this returns only on error.
+func (i *indexer) indexChanges(ctx context.Context, cursor, indexID string, follow bool) error {
+	i.l.Info("indexing changes", "cursor", cursor, "follow", follow)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	srv, err := i.model.WatchChanges(ctx, &spb.ModelWatchChangesRequest{
+		Cursor: cursor,
+		Follow: follow,
+	})
+	if err != nil {
+		return fmt.Errorf("WatchChanges: %w", err)
+	}
+
+	for {
+		chunk, err := srv.Recv()
+		if err == io.EOF {
+			if follow {
+				return fmt.Errorf("WatchChanges: unexpected end of stream")
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("WatchChanges: %w", err)
+		}
+		if len(chunk.Changes) == 0 {
+			continue
+		}
+
+		// Changes usually come in bursts for the same issue, so only
+		// reindex every issue once per chunk.
+		seen := make(map[int64]bool)
+		for _, c := range chunk.Changes {
+			if seen[c.IssueId] {
+				continue
+			}
+			seen[c.IssueId] = true
+			if err := i.index(ctx, c.IssueId); err != nil {
+				return fmt.Errorf("indexing issue %d: %w", c.IssueId, err)
+			}
+		}
+
+		// The Search index might have been rebuilt while the chunk was being
+		// indexed, in which case the checkpoint must not claim that the
+		// chunk's changes made it into the new index. Returning makes
+		// follow reconnect and reindex everything.
+		currentID, err := i.indexID(ctx)
+		if err != nil {
+			return err
+		}
+		if currentID != indexID {
+			return fmt.Errorf("search index changed from %q to %q", indexID, currentID)
+		}
+		cursor = chunk.Changes[len(chunk.Changes)-1].Cursor
+		if err := i.writeCheckpoint(cursor, indexID); err != nil {
+			return fmt.Errorf("could not write checkpoint: %w", err)
+		}
+	}
+}
+
+// index retrieves an issue with its comments from the Model and indexes both
+// the issue and every comment.
+func (i *indexer) index(ctx context.Context, id int64) error {
+	isrv, err := i.model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+		Query: &spb.ModelGetIssuesRequest_ById_{
+			ById: &spb.ModelGetIssuesRequest_ById{Id: id},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("GetIssues: %w", err)
+	}
+	ichunk, err := isrv.Recv()
+	if err != nil {
+		return fmt.Errorf("GetIssues: %w", err)
+	}
+	if len(ichunk.Issues) != 1 {
+		return fmt.Errorf("GetIssues: returned %d issues", len(ichunk.Issues))
+	}
+	issue := ichunk.Issues[0]
+
+	usrv, err := i.model.GetIssueUpdates(ctx, &spb.ModelGetIssueUpdatesRequest{
+		Id:   id,
+		Mode: spb.ModelGetIssueUpdatesRequest_MODE_STATUS_AND_UPDATES,
+		Pagination: &spb.PaginationSelector{
+			Count: math.MaxInt64,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("GetIssueUpdates: %w", err)
+	}
+	var comments []string
+	var updates []*cpb.Update
+	for {
+		uchunk, err := usrv.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("GetIssueUpdates: %w", err)
+		}
+		for _, u := range uchunk.Updates {
+			if u.Comment != "" {
+				comments = append(comments, u.Comment)
+				updates = append(updates, u)
+			}
+		}
+	}
+
+	_, err = i.search.IndexIssue(ctx, &spb.IndexIssueRequest{
+		Id:       id,
+		Title:    issue.Current.Title,
+		Comments: comments,
+		Open:     search.IssueStatusOpen(issue.Current.Status),
+	})
+	if err != nil {
+		return fmt.Errorf("IndexIssue: %w", err)
+	}
+	// Comments are also indexed separately, so that search hits can point
+	// at a particular comment.
+	for _, u := range updates {
+		_, err = i.search.IndexUpdate(ctx, &spb.IndexUpdateRequest{
+			IssueId:  id,
+			UpdateId: u.Id,
+			Comment:  u.Comment,
+		})
+		if err != nil {
+			return fmt.Errorf("IndexUpdate: %w", err)
+		}
+	}
+	i.l.Debug("indexed issue", "id", id, "comments", len(comments))
+	return nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "indexer")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	i := &indexer{
+		checkpoint: filepath.Join(dir, "checkpoint"),
+	}
+
+	// No checkpoint yet means starting from the beginning.
+	gotCursor, gotID, err := i.readCheckpoint()
+	if err != nil {
+		t.Fatalf("readCheckpoint: %v", err)
+	}
+	if gotCursor != "" || gotID != "" {
+		t.Fatalf("initial checkpoint is (%q, %q), wanted empty", gotCursor, gotID)
+	}
+
+	// Checkpoints written before index IDs were introduced contain only the
+	// cursor.
+	if err := ioutil.WriteFile(i.checkpoint, []byte("foo\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	gotCursor, gotID, err = i.readCheckpoint()
+	if err != nil {
+		t.Fatalf("readCheckpoint: %v", err)
+	}
+	if gotCursor != "foo" || gotID != "" {
+		t.Fatalf("old checkpoint is (%q, %q), wanted (\"foo\", \"\")", gotCursor, gotID)
+	}
+
+	for _, te := range []struct {
+		cursor, indexID string
+	}{
+		{"foo", "1234"},
+		{"bar", "1234"},
+		{"baz", "5678"},
+	} {
+		if err := i.writeCheckpoint(te.cursor, te.indexID); err != nil {
+			t.Fatalf("writeCheckpoint(%q, %q): %v", te.cursor, te.indexID, err)
+		}
+		gotCursor, gotID, err := i.readCheckpoint()
+		if err != nil {
+			t.Fatalf("readCheckpoint: %v", err)
+		}
+		if gotCursor != te.cursor || gotID != te.indexID {
+			t.Fatalf("checkpoint is (%q, %q), wanted (%q, %q)", gotCursor, gotID, te.cursor, te.indexID)
+		}
+	}
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if want, got := 1, len(files); want != got {
+		t.Fatalf("checkpoint directory contains %d files, wanted %d", got, want)
+	}
+}
+
+// fakeModel is a Model service serving canned issues and changes.
+type fakeModel struct {
+	mu sync.Mutex
+	// issues and updates are the issues and their updates, by issue ID.
+	issues  map[int64]*cpb.IssueState
+	updates map[int64][]*cpb.Update
+	// chunks are the chunks of the change feed.
+	chunks []*spb.ModelWatchChangesChunk
+}
+
+func (f *fakeModel) GetIssues(req *spb.ModelGetIssuesRequest, srv spb.Model_GetIssuesServer) error {
+	f.mu.Lock()
+	id := req.GetById().GetId()
+	state, ok := f.issues[id]
+	f.mu.Unlock()
+
+	res := &spb.ModelGetIssuesChunk{}
+	if ok {
+		res.Issues = append(res.Issues, &cpb.Issue{Id: id, Current: state})
+	}
+	return srv.Send(res)
+}
+
+func (f *fakeModel) GetIssueUpdates(req *spb.ModelGetIssueUpdatesRequest, srv spb.Model_GetIssueUpdatesServer) error {
+	f.mu.Lock()
+	updates := f.updates[req.Id]
+	f.mu.Unlock()
+	return srv.Send(&spb.ModelGetIssueUpdatesChunk{Updates: updates})
+}
+
+// WatchChanges sends the chunks of the change feed after the one ending with
+// the requested cursor, then ends the stream even if following.
+func (f *fakeModel) WatchChanges(req *spb.ModelWatchChangesRequest, srv spb.Model_WatchChangesServer) error {
+	chunks := f.chunks
+	if req.Cursor != "" {
+		for i, c := range chunks {
+			if c.Changes[len(c.Changes)-1].Cursor == req.Cursor {
+				chunks = chunks[i+1:]
+				break
+			}
+		}
+	}
+	for _, c := range chunks {
+		if err := srv.Send(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeModel) CountIssues(ctx context.Context, req *spb.ModelCountIssuesRequest) (*spb.ModelCountIssuesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) CompleteQuery(ctx context.Context, req *spb.ModelCompleteQueryRequest) (*spb.ModelCompleteQueryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) SuggestDuplicates(ctx context.Context, req *spb.ModelSuggestDuplicatesRequest) (*spb.ModelSuggestDuplicatesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) NewIssue(ctx context.Context, req *spb.ModelNewIssueRequest) (*spb.ModelNewIssueResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) UpdateIssue(ctx context.Context, req *spb.ModelUpdateIssueRequest) (*spb.ModelUpdateIssueResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) GetCategoryTree(ctx context.Context, req *spb.ModelGetCategoryTreeRequest) (*spb.ModelGetCategoryTreeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) NewCategory(ctx context.Context, req *spb.ModelNewCategoryRequest) (*spb.ModelNewCategoryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) UpdateCategory(ctx context.Context, req *spb.ModelUpdateCategoryRequest) (*spb.ModelUpdateCategoryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) DeleteCategory(ctx context.Context, req *spb.ModelDeleteCategoryRequest) (*spb.ModelDeleteCategoryResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) NewUser(ctx context.Context, req *spb.ModelNewUserRequest) (*spb.ModelNewUserResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) GetUsers(ctx context.Context, req *spb.ModelGetUsersRequest) (*spb.ModelGetUsersResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeModel) UpdateUser(ctx context.Context, req *spb.ModelUpdateUserRequest) (*spb.ModelUpdateUserResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+// fakeSearch is a Search service that records indexed documents.
+type fakeSearch struct {
+	mu sync.Mutex
+	// indexID is the ID of the index returned by GetIndexInfo.
+	indexID string
+	// issues and updates are the indexing requests received, in order.
+	issues  []*spb.IndexIssueRequest
+	updates []*spb.IndexUpdateRequest
+}
+
+func (f *fakeSearch) Query(req *spb.QueryRequest, srv spb.Search_QueryServer) error {
+	return status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeSearch) IndexIssue(ctx context.Context, req *spb.IndexIssueRequest) (*spb.IndexIssueResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issues = append(f.issues, req)
+	return &spb.IndexIssueResponse{}, nil
+}
+
+func (f *fakeSearch) IndexUpdate(ctx context.Context, req *spb.IndexUpdateRequest) (*spb.IndexUpdateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, req)
+	return &spb.IndexUpdateResponse{}, nil
+}
+
+func (f *fakeSearch) SuggestDuplicates(ctx context.Context, req *spb.SuggestDuplicatesRequest) (*spb.SuggestDuplicatesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeSearch) GetIndexInfo(ctx context.Context, req *spb.GetIndexInfoRequest) (*spb.GetIndexInfoResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &spb.GetIndexInfoResponse{IndexId: f.indexID}, nil
+}
+
+func (f *fakeSearch) DeleteIssue(ctx context.Context, req *spb.DeleteIssueRequest) (*spb.DeleteIssueResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeSearch) DeleteUpdate(ctx context.Context, req *spb.DeleteUpdateRequest) (*spb.DeleteUpdateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeSearch) GetIndexStats(ctx context.Context, req *spb.GetIndexStatsRequest) (*spb.GetIndexStatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+func (f *fakeSearch) MigrateKeys(ctx context.Context, req *spb.MigrateKeysRequest) (*spb.MigrateKeysResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented")
+}
+
+// indexedIssues returns the IDs of the issues indexed so far, in order.
+func (f *fakeSearch) indexedIssues() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []int64
+	for _, req := range f.issues {
+		res = append(res, req.Id)
+	}
+	return res
+}
+
+// dutConn returns a connection to a server with the given services registered,
+// served until ctx is canceled.
+func dutConn(ctx context.Context, register func(s *grpc.Server)) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	register(s)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}), grpc.WithInsecure())
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+		s.Stop()
+	}()
+
+	return conn
+}
+
+// dutIndexer returns an indexer talking to the given Model and Search
+// services, keeping its checkpoint at a given path.
+func dutIndexer(ctx context.Context, model spb.ModelServer, search spb.SearchServer, checkpoint string) *indexer {
+	conn := dutConn(ctx, func(s *grpc.Server) {
+		spb.RegisterModelServer(s, model)
+		spb.RegisterSearchServer(s, search)
+	})
+	return &indexer{
+		l:          log.New("component", "indexer"),
+		model:      spb.NewModelClient(conn),
+		search:     spb.NewSearchClient(conn),
+		checkpoint: checkpoint,
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	model := &fakeModel{
+		issues: map[int64]*cpb.IssueState{
+			1: {Title: "crash on startup", Status: cpb.IssueStatus_NEW},
+			2: {Title: "slow startup", Status: cpb.IssueStatus_FIXED},
+		},
+		updates: map[int64][]*cpb.Update{
+			1: {
+				{Id: 1, Comment: "it crashes"},
+				{Id: 2},
+				{Id: 3, Comment: "still crashing"},
+			},
+		},
+	}
+	search := &fakeSearch{}
+	i := dutIndexer(ctx, model, search, "")
+
+	for _, id := range []int64{1, 2} {
+		if err := i.index(ctx, id); err != nil {
+			t.Fatalf("index(%d): %v", id, err)
+		}
+	}
+	if err := i.index(ctx, 3); err == nil {
+		t.Errorf("indexing nonexistent issue succeeded")
+	}
+
+	wantIssues := []*spb.IndexIssueRequest{
+		{Id: 1, Title: "crash on startup", Comments: []string{"it crashes", "still crashing"}, Open: true},
+		{Id: 2, Title: "slow startup"},
+	}
+	if want, got := len(wantIssues), len(search.issues); want != got {
+		t.Fatalf("indexed %d issues, wanted %d", got, want)
+	}
+	for j, want := range wantIssues {
+		if got := search.issues[j]; !proto.Equal(want, got) {
+			t.Errorf("issue %d: indexed %v, wanted %v", j, got, want)
+		}
+	}
+
+	// Only updates with comments are indexed.
+	wantUpdates := []*spb.IndexUpdateRequest{
+		{IssueId: 1, UpdateId: 1, Comment: "it crashes"},
+		{IssueId: 1, UpdateId: 3, Comment: "still crashing"},
+	}
+	if want, got := len(wantUpdates), len(search.updates); want != got {
+		t.Fatalf("indexed %d updates, wanted %d", got, want)
+	}
+	for j, want := range wantUpdates {
+		if got := search.updates[j]; !proto.Equal(want, got) {
+			t.Errorf("update %d: indexed %v, wanted %v", j, got, want)
+		}
+	}
+}
+
+func TestIndexChanges(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	dir, err := ioutil.TempDir("", "indexer")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	change := func(cursor string, id int64) *spb.ModelWatchChangesChunk_Change {
+		return &spb.ModelWatchChangesChunk_Change{Cursor: cursor, IssueId: id}
+	}
+	model := &fakeModel{
+		issues: map[int64]*cpb.IssueState{
+			1: {Title: "foo"},
+			2: {Title: "bar"},
+		},
+		chunks: []*spb.ModelWatchChangesChunk{
+			{Changes: []*spb.ModelWatchChangesChunk_Change{
+				change("c1", 1), change("c2", 2), change("c3", 1),
+			}},
+			{Changes: []*spb.ModelWatchChangesChunk_Change{
+				change("c4", 1),
+			}},
+		},
+	}
+	search := &fakeSearch{indexID: "index1"}
+	i := dutIndexer(ctx, model, search, filepath.Join(dir, "checkpoint"))
+
+	checkCheckpoint := func(wantCursor, wantID string) {
+		t.Helper()
+		cursor, indexID, err := i.readCheckpoint()
+		if err != nil {
+			t.Fatalf("readCheckpoint: %v", err)
+		}
+		if cursor != wantCursor || indexID != wantID {
+			t.Errorf("checkpoint is (%q, %q), wanted (%q, %q)", cursor, indexID, wantCursor, wantID)
+		}
+	}
+
+	// Without follow, the end of the stream is the end of the changes.
+	// Every issue is indexed once per chunk.
+	if err := i.indexChanges(ctx, "", "index1", false); err != nil {
+		t.Fatalf("indexChanges: %v", err)
+	}
+	if want, got := "[1 2 1]", fmt.Sprint(search.indexedIssues()); want != got {
+		t.Errorf("indexed issues %s, wanted %s", got, want)
+	}
+	checkCheckpoint("c4", "index1")
+
+	// With follow, the end of the stream is an error, but the changes
+	// received until then are checkpointed.
+	search.issues = nil
+	if err := i.indexChanges(ctx, "c3", "index1", true); err == nil {
+		t.Errorf("indexChanges with follow returned at end of stream")
+	}
+	if want, got := "[1]", fmt.Sprint(search.indexedIssues()); want != got {
+		t.Errorf("indexed issues %s after c3, wanted %s", got, want)
+	}
+	checkCheckpoint("c4", "index1")
+
+	// A chunk is only checkpointed once all its issues have been indexed.
+	model.chunks = append(model.chunks, &spb.ModelWatchChangesChunk{
+		Changes: []*spb.ModelWatchChangesChunk_Change{
+			change("c5", 2), change("c6", 3),
+		},
+	})
+	if err := i.indexChanges(ctx, "c4", "index1", false); err == nil {
+		t.Errorf("indexChanges with nonexistent issue succeeded")
+	}
+	checkCheckpoint("c4", "index1")
+
+	// Neither is a chunk checkpointed if the index has been replaced in the
+	// meantime.
+	model.issues[3] = &cpb.IssueState{Title: "baz"}
+	search.indexID = "index2"
+	if err := i.indexChanges(ctx, "c4", "index1", false); err == nil {
+		t.Errorf("indexChanges into replaced index succeeded")
+	}
+	checkCheckpoint("c4", "index1")
+
+	// Which is why everything is reindexed into it.
+	search.issues = nil
+	if err := i.followOnce(ctx); err == nil {
+		t.Errorf("followOnce returned at end of stream")
+	}
+	if want, got := "[1 2 1 2 3]", fmt.Sprint(search.indexedIssues()); want != got {
+		t.Errorf("indexed issues %s into new index, wanted %s", got, want)
+	}
+	checkCheckpoint("c6", "index2")
+}
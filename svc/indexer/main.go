@@ -0,0 +1,87 @@
+// Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"flag"
+
+	"code.hackerspace.pl/hscloud/go/mirko"
+	"code.hackerspace.pl/hscloud/go/pki"
+	spb "github.com/q3k/bugless/proto/svc"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
+)
+
+var (
+	flagModel      string
+	flagSearch     string
+	flagCheckpoint string
+	flagBackfill   bool
+)
+
+func init() {
+	flag.Set("listen_address", "127.0.0.1:4230")
+	flag.Set("debug_address", "127.0.0.1:4231")
+}
+
+func main() {
+	flag.StringVar(&flagModel, "model", "127.0.0.1:4200", "Address of bugless model service")
+	flag.StringVar(&flagSearch, "search", "", "Address of bugless search service")
+	flag.StringVar(&flagCheckpoint, "checkpoint", "indexer.checkpoint", "Path to file in which the position in the model change feed is stored")
+	flag.BoolVar(&flagBackfill, "backfill", false, "Reindex all issues in the model, then exit. The checkpoint is updated, so that a subsequent run resumes where the backfill ended")
+	flag.Parse()
+	m := mirko.New()
+	l := log.New()
+
+	if flagSearch == "" {
+		l.Crit("search must be set")
+		return
+	}
+
+	if err := m.Listen(); err != nil {
+		l.Crit("could not listen", "err", err)
+		return
+	}
+
+	modelConn, err := grpc.Dial(flagModel, pki.WithClientHSPKI())
+	if err != nil {
+		l.Crit("could not dial model", "err", err)
+		return
+	}
+	searchConn, err := grpc.Dial(flagSearch, pki.WithClientHSPKI())
+	if err != nil {
+		l.Crit("could not dial search", "err", err)
+		return
+	}
+
+	i := &indexer{
+		l:          l.New("component", "indexer"),
+		model:      spb.NewModelClient(modelConn),
+		search:     spb.NewSearchClient(searchConn),
+		checkpoint: flagCheckpoint,
+	}
+
+	if flagBackfill {
+		if err := i.backfill(m.Context()); err != nil {
+			l.Crit("backfill failed", "err", err)
+			return
+		}
+		l.Info("backfill done")
+		return
+	}
+
+	if err := m.Serve(); err != nil {
+		l.Crit("could not serve", "err", err)
+		return
+	}
+
+	go func() {
+		if err := i.follow(m.Context()); err != nil {
+			l.Error("indexer stopped", "err", err)
+		}
+	}()
+
+	<-m.Done()
+}
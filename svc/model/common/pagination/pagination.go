@@ -1,8 +1,6 @@
 package pagination
 
 import (
-	"strconv"
-
 	spb "github.com/q3k/bugless/proto/svc"
 
 	"google.golang.org/grpc/codes"
@@ -56,6 +54,11 @@ import (
 //    then also gets tricky with invalidations, and in general pushes quite a
 //    bit of logic down to the consumer of this pagination API.
 //
+// This package solves the latter by giving API consumers tokens for both the
+// next and previous page. The previous page is served by first finding the
+// item preceding it (by querying the backing store in reverse order), and
+// then serving the page forwards from that item like any other page.
+//
 // Reference: Pagination done the Right Way, Markus Winand, 2013
 // https://www.slideshare.net/slideshow/embed_code/22210863
 //
@@ -73,7 +76,8 @@ import (
 // resampling of these to ensure database requests stay somewhat sane.
 //
 // To use this API, the producer needs to implement a ChunkSender function,
-// then call Resample (or ResampleInt64 in case pagination values are int64s).
+// then call Resample (or ResampleToken in case pagination values are page
+// Tokens, which is the case for all gRPC APIs).
 
 // V is the opaque, 'generic' type that's used to pass pagination 'values'
 // around.
@@ -135,23 +139,42 @@ func Resample(start V, count int64, c ChunkSender) error {
 	}
 }
 
-// ResampleInt64 runs Resample after parsing pagintion data from a proto,
-// interpreting the start value as an int64.
-func ResampleInt64(p *spb.PaginationSelector, c ChunkSender) error {
-	var after int64
+// Locator is a user declared function that finds the position of the n-th
+// item preceding a given position in the backing store (with the first
+// preceding item being n=1). If fewer than n items precede the position, nil
+// is returned.
+type Locator func(before *Token, n int64) (*Token, error)
+
+// ResampleToken runs Resample after parsing pagination data from a proto,
+// interpreting the start value as a page *Token (nil for the first page). If
+// the token is one of a previous page, the Locator is used to find the item
+// after which the page starts. If there's not enough items before the token
+// to fill the page, the first page is returned instead.
+func ResampleToken(p *spb.PaginationSelector, l Locator, c ChunkSender) error {
+	var after *Token
 	var count int64
-	var err error
 	if p != nil {
-		if p.After != "" {
-			after, err = strconv.ParseInt(p.After, 10, 64)
-			if err != nil {
-				return status.Error(codes.InvalidArgument, "invalid pagination 'after'")
-			}
+		var err error
+		after, err = DecodeToken(p.After)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid pagination 'after': %v", err)
 		}
 		count = p.Count
 	}
 	if count <= 0 {
 		count = 100
 	}
+	if after != nil && after.Before {
+		// The page starts after the item preceding all its items.
+		n := count + 1
+		if after.Inclusive {
+			n = count
+		}
+		var err error
+		after, err = l(after, n)
+		if err != nil {
+			return err
+		}
+	}
 	return Resample(after, count, c)
 }
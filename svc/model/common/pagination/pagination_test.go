@@ -0,0 +1,111 @@
+package pagination
+
+import (
+	"fmt"
+	"testing"
+
+	spb "github.com/q3k/bugless/proto/svc"
+)
+
+// fakeStore is a backing store of items 1..n, where the position of item i is
+// Token{ID: i}.
+type fakeStore struct {
+	n int64
+}
+
+func (f *fakeStore) locate(before *Token, n int64) (*Token, error) {
+	if id := before.ID - n; id > 0 {
+		return &Token{ID: id}, nil
+	}
+	return nil, nil
+}
+
+// page retrieves a page of items, returning them and the previous and next
+// page tokens.
+func (f *fakeStore) page(t *testing.T, after string, count int64) (items []int64, prev, next string) {
+	p := &spb.PaginationSelector{After: after, Count: count}
+	err := ResampleToken(p, f.locate, func(first bool, start V, count int64) (int, V, error) {
+		after := start.(*Token)
+		var firstItem *Token
+		id := int64(1)
+		if after != nil {
+			id = after.ID + 1
+		}
+		n := 0
+		for ; id <= f.n && int64(n) < count; id++ {
+			if firstItem == nil {
+				firstItem = &Token{ID: id}
+			}
+			items = append(items, id)
+			start = &Token{ID: id}
+			n++
+		}
+		if first {
+			prev = PrevPageToken(after, firstItem)
+		}
+		next = ""
+		if int64(n) == count {
+			next = start.(*Token).Encode()
+		}
+		return n, start, nil
+	})
+	if err != nil {
+		t.Fatalf("ResampleToken: %v", err)
+	}
+	return
+}
+
+func TestResampleToken(t *testing.T) {
+	f := &fakeStore{n: 250}
+
+	// Go forwards through all pages...
+	var pages []string
+	after := ""
+	for {
+		items, prev, next := f.page(t, after, 60)
+		if (after == "") != (prev == "") {
+			t.Fatalf("page %d: wanted previous page token iff not first page, got %q", len(pages), prev)
+		}
+		pages = append(pages, fmt.Sprintf("%v", items))
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	// The last page is short, so there's no next page.
+	if want, got := 5, len(pages); want != got {
+		t.Fatalf("wanted %d pages, got %d", want, got)
+	}
+
+	// ... then backwards.
+	_, before, _ := f.page(t, after, 60)
+	for i := len(pages) - 2; i >= 0; i-- {
+		items, prev, _ := f.page(t, before, 60)
+		if want, got := pages[i], fmt.Sprintf("%v", items); want != got {
+			t.Fatalf("page %d backwards: wanted %s, got %s", i, want, got)
+		}
+		before = prev
+	}
+	if before != "" {
+		t.Fatalf("wanted no previous page token on first page, got %q", before)
+	}
+
+	// A page preceding an empty page ends with the last item.
+	f = &fakeStore{n: 120}
+	_, _, next := f.page(t, "", 60)
+	_, _, next = f.page(t, next, 60)
+	items, prev, next := f.page(t, next, 60)
+	if len(items) != 0 || next != "" {
+		t.Fatalf("wanted empty last page, got %v, %q", items, next)
+	}
+	items, _, _ = f.page(t, prev, 60)
+	if want, got := fmt.Sprintf("%v", []int64{61, 120}), fmt.Sprintf("%v", []int64{items[0], items[len(items)-1]}); want != got {
+		t.Fatalf("wanted page preceding empty page to be %s, got %s", want, got)
+	}
+
+	// Previous pages that would be short are filled from the beginning.
+	items, prev, _ = f.page(t, (&Token{ID: 10, Before: true}).Encode(), 60)
+	if len(items) != 60 || items[0] != 1 || prev != "" {
+		t.Fatalf("wanted first page, got %v, %q", items, prev)
+	}
+}
@@ -0,0 +1,174 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// Token is an opaque position in a value-paginated list of items, ie. a page
+// token given to API consumers to retrieve the next (or previous) page of
+// results.
+//
+// As items are usually ordered by fields which are not unique (like a
+// priority, or even a nanosecond timestamp), a token contains the values of
+// all ordered fields of an item (its sort key), followed by a unique ID of
+// that item as a tiebreaker. The page following the token then starts with
+// the first item whose (key, ID) is after the token's (key, ID).
+type Token struct {
+	// Key are the values of the ordered fields of an item. Only int64 and
+	// string values are supported.
+	Key []interface{}
+	ID  int64
+	// Before is set for tokens of previous pages, ie. the page is made of the
+	// items preceding the position instead of following it.
+	Before bool
+	// Inclusive is set for tokens of previous pages that also include the
+	// item at the position.
+	Inclusive bool
+}
+
+const (
+	// tokenVersion is the first byte of encoded tokens, to allow for changing
+	// the encoding in the future.
+	tokenVersion byte = 1
+
+	tokenInt64  byte = 'i'
+	tokenString byte = 's'
+
+	tokenFlagBefore    byte = 1 << 0
+	tokenFlagInclusive byte = 1 << 1
+)
+
+// Encode returns the opaque string representation of a token, as given to API
+// consumers. Tokens are not signed or encrypted, so should only contain values
+// that consumers are allowed to see.
+func (t *Token) Encode() string {
+	var flags byte
+	if t.Before {
+		flags |= tokenFlagBefore
+	}
+	if t.Inclusive {
+		flags |= tokenFlagInclusive
+	}
+	buf := []byte{tokenVersion, flags}
+	tmp := make([]byte, binary.MaxVarintLen64)
+	uvarint := func(v uint64) {
+		n := binary.PutUvarint(tmp, v)
+		buf = append(buf, tmp[:n]...)
+	}
+	varint := func(v int64) {
+		n := binary.PutVarint(tmp, v)
+		buf = append(buf, tmp[:n]...)
+	}
+
+	uvarint(uint64(len(t.Key)))
+	for _, k := range t.Key {
+		switch v := k.(type) {
+		case int64:
+			buf = append(buf, tokenInt64)
+			varint(v)
+		case string:
+			buf = append(buf, tokenString)
+			uvarint(uint64(len(v)))
+			buf = append(buf, v...)
+		default:
+			panic(fmt.Sprintf("unsupported token key type %T", k))
+		}
+	}
+	varint(t.ID)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeToken parses a token from its opaque string representation. An empty
+// string decodes into a nil token, ie. the beginning of the list.
+func DecodeToken(s string) (*Token, error) {
+	if s == "" {
+		return nil, nil
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding: %w", err)
+	}
+	if len(buf) == 0 || buf[0] != tokenVersion {
+		return nil, fmt.Errorf("unknown version")
+	}
+	if len(buf) < 2 || buf[1]&^(tokenFlagBefore|tokenFlagInclusive) != 0 {
+		return nil, fmt.Errorf("invalid flags")
+	}
+	flags := buf[1]
+	buf = buf[2:]
+
+	uvarint := func() (uint64, bool) {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return 0, false
+		}
+		buf = buf[n:]
+		return v, true
+	}
+	varint := func() (int64, bool) {
+		v, n := binary.Varint(buf)
+		if n <= 0 {
+			return 0, false
+		}
+		buf = buf[n:]
+		return v, true
+	}
+
+	n, ok := uvarint()
+	if !ok || n > uint64(len(buf)) {
+		return nil, fmt.Errorf("invalid key")
+	}
+	t := &Token{
+		Before:    flags&tokenFlagBefore != 0,
+		Inclusive: flags&tokenFlagInclusive != 0,
+	}
+	for i := uint64(0); i < n; i++ {
+		if len(buf) == 0 {
+			return nil, fmt.Errorf("truncated key")
+		}
+		typ := buf[0]
+		buf = buf[1:]
+		switch typ {
+		case tokenInt64:
+			v, ok := varint()
+			if !ok {
+				return nil, fmt.Errorf("invalid key %d", i)
+			}
+			t.Key = append(t.Key, v)
+		case tokenString:
+			l, ok := uvarint()
+			if !ok || l > uint64(len(buf)) {
+				return nil, fmt.Errorf("invalid key %d", i)
+			}
+			t.Key = append(t.Key, string(buf[:l]))
+			buf = buf[l:]
+		default:
+			return nil, fmt.Errorf("invalid key %d type", i)
+		}
+	}
+	if t.ID, ok = varint(); !ok {
+		return nil, fmt.Errorf("invalid ID")
+	}
+	if len(buf) != 0 {
+		return nil, fmt.Errorf("trailing data")
+	}
+	return t, nil
+}
+
+// PrevPageToken returns the encoded token of the page preceding a page that
+// starts after a given position (nil for the first page), given the position of
+// its first item (nil if the page is empty). If the page is known to be the
+// first one, an empty string is returned.
+func PrevPageToken(after, first *Token) string {
+	if after == nil {
+		return ""
+	}
+	if first != nil {
+		return (&Token{Key: first.Key, ID: first.ID, Before: true}).Encode()
+	}
+	// The page is empty, so the previous page ends with the item at which it
+	// starts.
+	return (&Token{Key: after.Key, ID: after.ID, Before: true, Inclusive: true}).Encode()
+}
@@ -0,0 +1,49 @@
+package pagination
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestTokenRoundtrip(t *testing.T) {
+	for i, te := range []*Token{
+		{},
+		{ID: 1337},
+		{Key: []interface{}{int64(1592568000123456789)}, ID: 1},
+		{Key: []interface{}{int64(-2), "", "zażółć, gęślą jaźń"}, ID: math.MaxInt64},
+		{Key: []interface{}{"q3k", int64(math.MinInt64)}, ID: -1},
+		{Key: []interface{}{int64(3)}, ID: 4, Before: true},
+		{ID: 5, Before: true, Inclusive: true},
+	} {
+		s := te.Encode()
+		got, err := DecodeToken(s)
+		if err != nil {
+			t.Errorf("test %d: DecodeToken(%q): %v", i, s, err)
+			continue
+		}
+		if want, got := fmt.Sprintf("%#v", te), fmt.Sprintf("%#v", got); want != got {
+			t.Errorf("test %d: wanted %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestTokenInvalid(t *testing.T) {
+	valid := (&Token{Key: []interface{}{int64(1), "foo"}, ID: 2}).Encode()
+	for i, s := range []string{
+		"1234",
+		"!!!",
+		"AA",
+		valid[:len(valid)-2],
+		valid + "AA",
+	} {
+		if tok, err := DecodeToken(s); err == nil {
+			t.Errorf("test %d: DecodeToken(%q) returned %v, wanted error", i, s, tok)
+		}
+	}
+
+	tok, err := DecodeToken("")
+	if err != nil || tok != nil {
+		t.Errorf("DecodeToken(\"\") returned %v, %v, wanted nil token", tok, err)
+	}
+}
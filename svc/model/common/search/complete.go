@@ -0,0 +1,120 @@
+package search
+
+import "strings"
+
+// CompletionKind is the kind of query part that's being typed at a position
+// within a query.
+type CompletionKind int
+
+const (
+	CompletionInvalid CompletionKind = iota
+	// CompletionField is a field name of a key/value term, or a keyword (which
+	// might still turn out to be a field name).
+	CompletionField
+	// CompletionValue is the value of a key/value term.
+	CompletionValue
+)
+
+// Completion describes the part of a query that's being typed at a position
+// within it, eg. at the cursor of a search box.
+type Completion struct {
+	Kind CompletionKind
+	// Key is the canonical name of the field whose value is being typed, and
+	// Comparison the predicate of its term. Both are only set for
+	// CompletionValue.
+	Key        string
+	Comparison Comparison
+	// Prefix is what has already been typed, ie. the part of the field name
+	// or value that's before the position.
+	Prefix string
+	// Span is the part of the query to be replaced by a completion: the whole
+	// field name or value that's being typed (or, for comma-separated lists
+	// of values, the list element that's being typed). It's empty if nothing
+	// has been typed yet.
+	Span Span
+}
+
+// CompleteAt returns what is being typed at a given byte offset within a
+// query. The query is lexed and split into terms the same way as by
+// ParseSearch, so that eg. the value of a key/value term is recognized as
+// such no matter how the term is spaced or quoted.
+func CompleteAt(s string, pos int) *Completion {
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(s) {
+		pos = len(s)
+	}
+
+	l := lexer{s: s}
+	tokens, _ := l.lex()
+
+	// Find the word being typed, ie. the one that contains the position or
+	// ends at it. If there's none, an empty word is being typed at the
+	// position.
+	i := 0
+	for i < len(tokens) && tokens[i].start < pos {
+		if tokens[i].typ == tokenWord && tokens[i].end >= pos {
+			break
+		}
+		i++
+	}
+	if i == len(tokens) || tokens[i].typ != tokenWord || tokens[i].start >= pos {
+		empty := token{tokenWord, "", pos, pos}
+		tokens = append(tokens[:i], append([]token{empty}, tokens[i:]...)...)
+	}
+	word := tokens[i]
+
+	res := &Completion{
+		Kind: CompletionField,
+		Span: word.span(),
+	}
+	// An empty word inserted at the position is never quoted, even if
+	// followed by a quote.
+	quoted := word.start < pos && strings.HasPrefix(s[word.start:], `"`)
+
+	// The word is a value if it's part of a constraint in the same place as
+	// the parser would see it.
+	p := parser{tokens: tokens}
+	for len(p.tokens) > 0 {
+		at := len(tokens) - len(p.tokens)
+		c := p.parseConstraint()
+		if c == nil {
+			p.read(1)
+			continue
+		}
+		if at+2 == i {
+			res.Kind = CompletionValue
+			res.Key = c.field()
+			res.Comparison = c.comparison()
+			break
+		}
+	}
+
+	start := word.start
+	if quoted {
+		start++
+	}
+	switch {
+	case res.Kind == CompletionField && !quoted && start < pos && strings.HasPrefix(s[start:], "-"):
+		// A lone minus at the end of the query is lexed as a word, but is
+		// just the negation of the word being typed. A minus after the
+		// position is not part of what's being typed.
+		start++
+		res.Span.Start = start
+	case res.Kind == CompletionValue && !quoted:
+		// Only complete the list element being typed.
+		if comma := strings.LastIndex(s[start:pos], ","); comma != -1 {
+			start += comma + 1
+			res.Span.Start = start
+		}
+		if comma := strings.Index(s[pos:word.end], ","); comma != -1 {
+			res.Span.End = pos + comma
+		}
+	}
+	if start > pos {
+		start = pos
+	}
+	res.Prefix = s[start:pos]
+	return res
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompleteAt(t *testing.T) {
+	for i, te := range []struct {
+		// s is the query, with the position marked by a '|'.
+		s          string
+		kind       CompletionKind
+		key        string
+		comparison Comparison
+		prefix     string
+		// span is the part of the query to be replaced.
+		span string
+	}{
+		{"|", CompletionField, "", ComparisonEqual, "", ""},
+		{"auth|", CompletionField, "", ComparisonEqual, "auth", "auth"},
+		{"au|th", CompletionField, "", ComparisonEqual, "au", "auth"},
+		{"foo |", CompletionField, "", ComparisonEqual, "", ""},
+		{"foo -auth|", CompletionField, "", ComparisonEqual, "auth", "auth"},
+		{"foo -|", CompletionField, "", ComparisonEqual, "", ""},
+		{"(foo OR sta|)", CompletionField, "", ComparisonEqual, "sta", "sta"},
+		{"author:|", CompletionValue, "author", ComparisonEqual, "", ""},
+		{"Author:q3|", CompletionValue, "author", ComparisonEqual, "q3", "q3"},
+		{"author: q|3k foo", CompletionValue, "author", ComparisonEqual, "q", "q3k"},
+		{`author:"q3|`, CompletionValue, "author", ComparisonEqual, "q3", `"q3`},
+		{"-assignee:|", CompletionValue, "assignee", ComparisonEqual, "", ""},
+		{"status:new,ass|", CompletionValue, "status", ComparisonEqual, "ass", "ass"},
+		{"status:new,ac|c,fixed", CompletionValue, "status", ComparisonEqual, "ac", "acc"},
+		{"p<|", CompletionValue, "priority", ComparisonLess, "", ""},
+		{"status:new |", CompletionField, "", ComparisonEqual, "", ""},
+		{"status:new type|", CompletionField, "", ComparisonEqual, "type", "type"},
+		{"a:b:c|", CompletionField, "", ComparisonEqual, "c", "c"},
+		{"|:foo", CompletionField, "", ComparisonEqual, "", ""},
+		// Words starting after the position are not being typed.
+		{"|-", CompletionField, "", ComparisonEqual, "", ""},
+		{"|-foo", CompletionField, "", ComparisonEqual, "", ""},
+		{"a |-b", CompletionField, "", ComparisonEqual, "", ""},
+		{`|"foo"`, CompletionField, "", ComparisonEqual, "", ""},
+	} {
+		pos := strings.Index(te.s, "|")
+		s := te.s[:pos] + te.s[pos+1:]
+		c := CompleteAt(s, pos)
+		if want, got := te.kind, c.Kind; want != got {
+			t.Errorf("test %d: wanted kind %v, got %v", i, want, got)
+		}
+		if want, got := te.key, c.Key; want != got {
+			t.Errorf("test %d: wanted key %q, got %q", i, want, got)
+		}
+		if want, got := te.comparison, c.Comparison; want != got {
+			t.Errorf("test %d: wanted comparison %v, got %v", i, want, got)
+		}
+		if want, got := te.prefix, c.Prefix; want != got {
+			t.Errorf("test %d: wanted prefix %q, got %q", i, want, got)
+		}
+		if want, got := te.span, s[c.Span.Start:c.Span.End]; want != got {
+			t.Errorf("test %d: wanted span %q, got %q", i, want, got)
+		}
+	}
+}
@@ -1,20 +1,41 @@
 package search
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // lexer is a simple lexer/tokenizer/scanner for the bugless query language.
-// It emits two types of tokens:
+// It emits the following types of tokens:
 //  - word, ie a whitespace separated literal that's part of the query, that
 //    can also be the result of grouping several query words into one query
 //    word by wrapping them in "double quotes"
 //  - colon, which is the ':' literal that's part of the query
+//  - comparison, which is one of the '<', '<=', '>' or '>=' literals
+//  - lparen and rparen, which are the '(' and ')' literals
+//  - minus, which is a '-' literal at the beginning of a word
+//  - or and and, which are the unquoted OR and AND words
 //
 // For example, the query:
 //    title: foo "bar baz"bar : foo
 // Would yield the following tokens:
 //    word(title), colon, word(foo), word(bar baz), word(bar), colon, word(foo)
+//
+// The query:
+//    priority<=2 updated>-14d
+// Would yield the following tokens:
+//    word(priority), comparison(<=), word(2), word(updated), comparison(>),
+//    word(-14d)
+//
+// And the query:
+//    -(author:q3k OR "OR") foo-bar
+// Would yield the following tokens:
+//    minus, lparen, word(author), colon, word(q3k), or, word(OR), rparen,
+//    word(foo-bar)
 type lexer struct {
 	s string
+	// pos is the amount of bytes of the query already read.
+	pos int
 }
 
 type token struct {
@@ -22,6 +43,13 @@ type token struct {
 	typ tokenType
 	// content is the literal, query-sourced content of the token.
 	content string
+	// start and end are byte offsets of the token within the query, [start,
+	// end). For quoted words, this includes the quotes.
+	start, end int
+}
+
+func (t token) span() Span {
+	return Span{t.start, t.end}
 }
 
 type tokenType int
@@ -35,6 +63,20 @@ const (
 	// tokenColon is the literal ':' character that was part of the query (if
 	// not quoted as part of a word).
 	tokenColon
+	// tokenComparison is one of the literal '<', '<=', '>' or '>=' operators
+	// that were part of the query (if not quoted as part of a word).
+	tokenComparison
+	// tokenLParen and tokenRParen are the literal '(' and ')' characters that
+	// were part of the query (if not quoted as part of a word).
+	tokenLParen
+	tokenRParen
+	// tokenMinus is a literal '-' character that starts a word (if not quoted
+	// or part of a constraint value), and negates whatever follows it.
+	tokenMinus
+	// tokenOr and tokenAnd are the literal, unquoted, upper case words OR and
+	// AND.
+	tokenOr
+	tokenAnd
 )
 
 func (t token) String() string {
@@ -43,6 +85,18 @@ func (t token) String() string {
 		return fmt.Sprintf("WORD<%q>", t.content)
 	case tokenColon:
 		return "COLON"
+	case tokenComparison:
+		return fmt.Sprintf("COMPARISON<%s>", t.content)
+	case tokenLParen:
+		return "LPAREN"
+	case tokenRParen:
+		return "RPAREN"
+	case tokenMinus:
+		return "MINUS"
+	case tokenOr:
+		return "OR"
+	case tokenAnd:
+		return "AND"
 	}
 	return "UNKNOWN"
 }
@@ -53,40 +107,88 @@ func (l *lexer) read(n int) (string, bool) {
 	}
 	val := l.s[:n]
 	l.s = l.s[n:]
+	l.pos += n
 	return val, true
 }
 
+// lex returns all tokens of the query. If the query ends within a quoted word,
+// the word is still returned, but terminated is false.
 func (l *lexer) lex() (tokens []token, terminated bool) {
 	word := ""
+	wordStart := 0
+
+	// flush emits the currently accumulated unquoted word, if any.
+	flush := func() {
+		typ := tokenWord
+		switch word {
+		case "":
+			return
+		case "OR":
+			typ = tokenOr
+		case "AND":
+			typ = tokenAnd
+		}
+		tokens = append(tokens, token{typ, word, wordStart, wordStart + len(word)})
+		word = ""
+	}
+	// emit emits a token that ends at the current position.
+	emit := func(typ tokenType, content string) {
+		tokens = append(tokens, token{typ, content, l.pos - len(content), l.pos})
+	}
 
 	for {
 		c, ok := l.read(1)
 		if !ok {
-			if word != "" {
-				tokens = append(tokens, token{tokenWord, word})
-				word = ""
-			}
+			flush()
 			terminated = true
 			return
 		}
 
 		switch c {
 		case ":":
-			if word != "" {
-				tokens = append(tokens, token{tokenWord, word})
-				word = ""
+			flush()
+			emit(tokenColon, c)
+			continue
+		case "<":
+			fallthrough
+		case ">":
+			flush()
+			if strings.HasPrefix(l.s, "=") {
+				l.read(1)
+				c += "="
 			}
-			tokens = append(tokens, token{tokenColon, c})
+			emit(tokenComparison, c)
 			continue
+		case "(":
+			fallthrough
+		case ")":
+			flush()
+			typ := tokenLParen
+			if c == ")" {
+				typ = tokenRParen
+			}
+			emit(typ, c)
+			continue
+		case "-":
+			// A minus negates the following word or group, unless it's in the
+			// middle of a word (foo-bar), the value of a constraint
+			// (foo:-bar, foo<-bar) or doesn't precede anything (foo - bar).
+			if word == "" && !endsWith(tokens, tokenColon, tokenComparison) && l.startsTerm() {
+				emit(tokenMinus, c)
+				continue
+			}
+			if word == "" {
+				wordStart = l.pos - 1
+			}
+			word += c
 		case "\"":
 			escaped := false
-			if word != "" {
-				tokens = append(tokens, token{tokenWord, word})
-				word = ""
-			}
+			flush()
+			start := l.pos - 1
 			for {
 				c, ok := l.read(1)
 				if !ok {
+					tokens = append(tokens, token{tokenWord, word, start, l.pos})
 					return
 				}
 				if c == "\\" && !escaped {
@@ -94,7 +196,7 @@ func (l *lexer) lex() (tokens []token, terminated bool) {
 					continue
 				}
 				if c == "\"" && !escaped {
-					tokens = append(tokens, token{tokenWord, word})
+					tokens = append(tokens, token{tokenWord, word, start, l.pos})
 					word = ""
 					break
 				}
@@ -106,12 +208,39 @@ func (l *lexer) lex() (tokens []token, terminated bool) {
 		case " ":
 			fallthrough
 		case "\t":
-			if word != "" {
-				tokens = append(tokens, token{tokenWord, word})
-				word = ""
-			}
+			flush()
 		default:
+			if word == "" {
+				wordStart = l.pos - 1
+			}
 			word += c
 		}
 	}
 }
+
+// endsWith returns whether the last of the given tokens is of any of the given
+// types.
+func endsWith(tokens []token, types ...tokenType) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	for _, typ := range types {
+		if tokens[len(tokens)-1].typ == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// startsTerm returns whether the remaining query starts with something that
+// can be negated, ie. a word or a group.
+func (l *lexer) startsTerm() bool {
+	if len(l.s) == 0 {
+		return false
+	}
+	switch l.s[0] {
+	case ' ', '\t', ')', ':', '<', '>':
+		return false
+	}
+	return true
+}
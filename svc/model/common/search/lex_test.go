@@ -5,6 +5,11 @@ import (
 	"testing"
 )
 
+// tok returns a token of a given type and content, at no particular position.
+func tok(typ tokenType, content string) token {
+	return token{typ: typ, content: content}
+}
+
 func (t token) diff(o token) string {
 	if want, got := t.typ, o.typ; want != got {
 		return fmt.Sprintf("want type %v, got type %v", want, got)
@@ -21,21 +26,45 @@ func TestLex(t *testing.T) {
 		terminated bool
 		want       []token
 	}{
-		{"foo bar", true, []token{{tokenWord, "foo"}, {tokenWord, "bar"}}},
-		{" 	foo 	 bar	", true, []token{{tokenWord, "foo"}, {tokenWord, "bar"}}},
+		{"foo bar", true, []token{tok(tokenWord, "foo"), tok(tokenWord, "bar")}},
+		{" 	foo 	 bar	", true, []token{tok(tokenWord, "foo"), tok(tokenWord, "bar")}},
 		{"  \"bug less\" bug less ", true, []token{
-			{tokenWord, "bug less"}, {tokenWord, "bug"}, {tokenWord, "less"},
+			tok(tokenWord, "bug less"), tok(tokenWord, "bug"), tok(tokenWord, "less"),
 		}},
 		{"error \"\\\"foo\\\" not defined\"", true, []token{
-			{tokenWord, "error"}, {tokenWord, "\"foo\" not defined"},
+			tok(tokenWord, "error"), tok(tokenWord, "\"foo\" not defined"),
 		}},
 		{"author:q3k foo bar baz", true, []token{
-			{tokenWord, "author"}, {tokenColon, ":"}, {tokenWord, "q3k"},
-			{tokenWord, "foo"}, {tokenWord, "bar"}, {tokenWord, "baz"},
+			tok(tokenWord, "author"), tok(tokenColon, ":"), tok(tokenWord, "q3k"),
+			tok(tokenWord, "foo"), tok(tokenWord, "bar"), tok(tokenWord, "baz"),
 		}},
 		{"title:\"bug less\" author:q3k", true, []token{
-			{tokenWord, "title"}, {tokenColon, ":"}, {tokenWord, "bug less"},
-			{tokenWord, "author"}, {tokenColon, ":"}, {tokenWord, "q3k"},
+			tok(tokenWord, "title"), tok(tokenColon, ":"), tok(tokenWord, "bug less"),
+			tok(tokenWord, "author"), tok(tokenColon, ":"), tok(tokenWord, "q3k"),
+		}},
+		{"-(author:q3k OR \"OR\") AND foo-bar", true, []token{
+			tok(tokenMinus, "-"), tok(tokenLParen, "("),
+			tok(tokenWord, "author"), tok(tokenColon, ":"), tok(tokenWord, "q3k"),
+			tok(tokenOr, "OR"), tok(tokenWord, "OR"), tok(tokenRParen, ")"),
+			tok(tokenAnd, "AND"), tok(tokenWord, "foo-bar"),
+		}},
+		{"-\"foo bar\" priority:-1 - or", true, []token{
+			tok(tokenMinus, "-"), tok(tokenWord, "foo bar"),
+			tok(tokenWord, "priority"), tok(tokenColon, ":"), tok(tokenWord, "-1"),
+			tok(tokenWord, "-"), tok(tokenWord, "or"),
+		}},
+		{"priority<=2 updated>-14d created< 2020-06-01 p>=1", true, []token{
+			tok(tokenWord, "priority"), tok(tokenComparison, "<="), tok(tokenWord, "2"),
+			tok(tokenWord, "updated"), tok(tokenComparison, ">"), tok(tokenWord, "-14d"),
+			tok(tokenWord, "created"), tok(tokenComparison, "<"), tok(tokenWord, "2020-06-01"),
+			tok(tokenWord, "p"), tok(tokenComparison, ">="), tok(tokenWord, "1"),
+		}},
+		{"foo \"bar baz", false, []token{
+			tok(tokenWord, "foo"), tok(tokenWord, "bar baz"),
+		}},
+		{"(foo)bar", true, []token{
+			tok(tokenLParen, "("), tok(tokenWord, "foo"), tok(tokenRParen, ")"),
+			tok(tokenWord, "bar"),
 		}},
 	} {
 		l := &lexer{s: te.s}
@@ -58,3 +87,19 @@ func TestLex(t *testing.T) {
 		}
 	}
 }
+
+func TestLexPositions(t *testing.T) {
+	s := `author:"q3k x" -(p<=2)`
+	l := &lexer{s: s}
+	tokens, _ := l.lex()
+	want := []string{`author`, `:`, `"q3k x"`, `-`, `(`, `p`, `<=`, `2`, `)`}
+	if len(want) != len(tokens) {
+		t.Fatalf("wanted %d tokens, got %v", len(want), tokens)
+	}
+	for i, w := range want {
+		tok := tokens[i]
+		if got := s[tok.start:tok.end]; w != got {
+			t.Errorf("token %d (%v): wanted span %q, got %q", i, tok, w, got)
+		}
+	}
+}
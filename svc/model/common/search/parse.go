@@ -1,8 +1,37 @@
 package search
 
+import "fmt"
+
 // parser for bugless query language.
+//
+// The grammar of the language is as follows:
+//
+//    query      = { or | garbage } ;
+//    or         = and , { OR , and } ;
+//    and        = unary , { [ AND ] , unary } ;
+//    unary      = MINUS , unary | primary ;
+//    primary    = LPAREN , or , [ RPAREN ] | constraint | word ;
+//    constraint = WORD , ( COLON | COMPARISON ) , WORD ;
+//    word       = WORD ;
+//
+// Where garbage is any token that cannot start an expression at that point
+// (for example, a stray colon or an unmatched closing parenthesis). Garbage is
+// ignored, and so are operators missing an operand - both are reported as
+// warnings. Consecutive expressions are ANDed together, ie. the AND operator
+// is optional.
 type parser struct {
 	tokens []token
+	// errors are problems found while parsing.
+	errors []*Error
+}
+
+// warn records a warning about a part of the query spanned by tokens.
+func (p *parser) warn(first, last token, format string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{
+		Severity: SeverityWarning,
+		Span:     Span{first.start, last.end},
+		Message:  fmt.Sprintf(format, args...),
+	})
 }
 
 func (p *parser) peek(n int) ([]token, bool) {
@@ -20,15 +49,27 @@ func (p *parser) read(n int) ([]token, bool) {
 	return val, ok
 }
 
+// next returns whether the next token is of the given type.
+func (p *parser) next(typ tokenType) bool {
+	toks, ok := p.peek(1)
+	return ok && toks[0].typ == typ
+}
+
 // nodeQuery is the top-level AST node of the query.
-// It is made up of elements of the query, that can be a constraint (a
-// key:value pair) or a word (a word that's not part of a key:value pair).
+// It is made up of a boolean expression, or nil if the query contains no
+// expressions.
 type nodeQuery struct {
-	elems []nodeConstraintOrWord
+	expr *nodeExpr
 }
 
-// nodeConstraint is a constraint or word. One and only one field must be set.
-type nodeConstraintOrWord struct {
+// nodeExpr is a boolean expression. One and only one field must be set.
+type nodeExpr struct {
+	// and is a conjunction of two or more expressions.
+	and []*nodeExpr
+	// or is a disjunction of two or more expressions.
+	or []*nodeExpr
+	// not is a negated expression.
+	not        *nodeExpr
 	constraint *nodeConstraint
 	word       *nodeWord
 }
@@ -37,8 +78,8 @@ type nodeConstraintOrWord struct {
 type nodeConstraint struct {
 	// key is the part before the colon, ie. the field name.
 	key token
-	// sep is the separator/predicate of the constraint, currently only ':'
-	// (equality).
+	// sep is the separator/predicate of the constraint, either ':' (equality)
+	// or a comparison.
 	sep token
 	// value is the part after che colon, ie. the field value filter.
 	value token
@@ -50,28 +91,162 @@ type nodeWord struct {
 	word token
 }
 
+// newAnd returns a conjunction of the given non-nil expressions, or the
+// expression itself if there's only one, or nil if there's none.
+func newAnd(exprs []*nodeExpr) *nodeExpr {
+	switch len(exprs) {
+	case 0:
+		return nil
+	case 1:
+		return exprs[0]
+	}
+	return &nodeExpr{and: exprs}
+}
+
+// newOr returns a disjunction of the given non-nil expressions, or the
+// expression itself if there's only one, or nil if there's none.
+func newOr(exprs []*nodeExpr) *nodeExpr {
+	switch len(exprs) {
+	case 0:
+		return nil
+	case 1:
+		return exprs[0]
+	}
+	return &nodeExpr{or: exprs}
+}
+
 func (p *parser) parse() *nodeQuery {
-	res := &nodeQuery{}
+	var exprs []*nodeExpr
 	for {
-		constraint := p.parseConstraint()
-		if constraint != nil {
-			res.elems = append(res.elems, nodeConstraintOrWord{constraint: constraint})
-			continue
+		if expr := p.parseOr(); expr != nil {
+			exprs = append(exprs, expr)
+		}
+		// parseOr only stops at the end of the query or at an unmatched
+		// closing parenthesis. Ignore the latter and carry on.
+		toks, ok := p.read(1)
+		if !ok {
+			break
 		}
+		p.warn(toks[0], toks[0], "unmatched ')', ignored")
+	}
+	return &nodeQuery{
+		expr: newAnd(exprs),
+	}
+}
 
-		word := p.parseWord()
-		if word != nil {
-			res.elems = append(res.elems, nodeConstraintOrWord{word: word})
-			continue
+func (p *parser) parseOr() *nodeExpr {
+	var exprs []*nodeExpr
+	var or []token
+	for {
+		expr := p.parseAnd()
+		if expr != nil {
+			exprs = append(exprs, expr)
+		} else if len(or) > 0 {
+			p.warn(or[0], or[0], "OR is missing an operand, ignored")
+		}
+		if !p.next(tokenOr) {
+			break
+		}
+		or, _ = p.read(1)
+		if expr == nil {
+			p.warn(or[0], or[0], "OR is missing an operand, ignored")
 		}
+	}
+	return newOr(exprs)
+}
 
-		// last token not even a word, just ignore it.
-		_, ok := p.read(1)
+func (p *parser) parseAnd() *nodeExpr {
+	var exprs []*nodeExpr
+	for {
+		toks, ok := p.peek(1)
 		if !ok {
 			break
 		}
+		switch toks[0].typ {
+		case tokenOr, tokenRParen:
+			return newAnd(exprs)
+		case tokenAnd:
+			p.read(1)
+			if len(exprs) == 0 || !p.startsExpr() {
+				p.warn(toks[0], toks[0], "AND is missing an operand, ignored")
+			}
+			continue
+		}
+
+		remaining := len(p.tokens)
+		expr := p.parseUnary()
+		if expr == nil {
+			// Not an expression, just ignore it - unless it was an empty
+			// group or similar, which has already been consumed (and
+			// reported).
+			if len(p.tokens) == remaining {
+				p.read(1)
+				if toks[0].typ == tokenColon || toks[0].typ == tokenComparison {
+					p.warn(toks[0], toks[0], "dangling '%s' (not part of a key%svalue filter), ignored", toks[0].content, toks[0].content)
+				} else {
+					p.warn(toks[0], toks[0], "unexpected '%s', ignored", toks[0].content)
+				}
+			}
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+	return newAnd(exprs)
+}
+
+// startsExpr returns whether the next token can start an expression.
+func (p *parser) startsExpr() bool {
+	toks, ok := p.peek(1)
+	if !ok {
+		return false
+	}
+	switch toks[0].typ {
+	case tokenWord, tokenMinus, tokenLParen:
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseUnary() *nodeExpr {
+	if !p.next(tokenMinus) {
+		return p.parsePrimary()
+	}
+	minus, _ := p.read(1)
+	expr := p.parseUnary()
+	if expr == nil {
+		p.warn(minus[0], minus[0], "nothing to negate, ignored")
+		return nil
+	}
+	return &nodeExpr{not: expr}
+}
+
+func (p *parser) parsePrimary() *nodeExpr {
+	if p.next(tokenLParen) {
+		lparen, _ := p.read(1)
+		expr := p.parseOr()
+		// Tolerate a missing closing parenthesis at the end of the query.
+		rparen, ok := p.peek(1)
+		if ok && rparen[0].typ == tokenRParen {
+			p.read(1)
+			if expr == nil {
+				p.warn(lparen[0], rparen[0], "empty group, ignored")
+			}
+		} else {
+			p.warn(lparen[0], lparen[0], "missing ')'")
+		}
+		return expr
+	}
+
+	constraint := p.parseConstraint()
+	if constraint != nil {
+		return &nodeExpr{constraint: constraint}
+	}
+
+	word := p.parseWord()
+	if word != nil {
+		return &nodeExpr{word: word}
 	}
-	return res
+	return nil
 }
 
 func (p *parser) parseConstraint() *nodeConstraint {
@@ -79,7 +254,7 @@ func (p *parser) parseConstraint() *nodeConstraint {
 	if !ok {
 		return nil
 	}
-	if toks[0].typ != tokenWord || toks[1].typ != tokenColon || toks[2].typ != tokenWord {
+	if toks[0].typ != tokenWord || (toks[1].typ != tokenColon && toks[1].typ != tokenComparison) || toks[2].typ != tokenWord {
 		return nil
 	}
 	p.read(3)
@@ -2,112 +2,112 @@ package search
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
-func (n *nodeQuery) diff(o *nodeQuery) string {
-	if want, got := len(n.elems), len(o.elems); want != got {
-		return fmt.Sprintf("element count differ, want %+v, got %+v", n, o)
+// String returns a lisp-like representation of the expression, for
+// comparison in tests.
+func (n *nodeExpr) String() string {
+	if n == nil {
+		return "nil"
 	}
-
-	for i, w := range n.elems {
-		g := o.elems[i]
-		if diff := w.diff(&g); diff != "" {
-			return fmt.Sprintf("element %d: %v", i, diff)
-		}
-	}
-	return ""
-}
-
-func (n *nodeConstraintOrWord) diff(o *nodeConstraintOrWord) string {
-	if n.constraint != nil {
-		if o.constraint == nil {
-			return fmt.Sprintf("want constraint, got word")
-		}
-		if diff := n.constraint.diff(o.constraint); diff != "" {
-			return fmt.Sprintf("constraint: %v", diff)
-		}
-	}
-	if n.word != nil {
-		if o.word == nil {
-			return fmt.Sprintf("want word, got constraint")
-		}
-		if diff := n.word.diff(o.word); diff != "" {
-			return fmt.Sprintf("word: %v", diff)
-		}
+	switch {
+	case n.constraint != nil:
+		return fmt.Sprintf("%s%s%s", n.constraint.key.content, n.constraint.sep.content, n.constraint.value.content)
+	case n.word != nil:
+		return n.word.word.content
+	case n.not != nil:
+		return fmt.Sprintf("(not %v)", n.not)
 	}
-	return ""
-}
-
-func (n *nodeConstraint) diff(o *nodeConstraint) string {
-	if diff := n.key.diff(o.key); diff != "" {
-		return fmt.Sprintf("key: %v", diff)
-	}
-	if diff := n.sep.diff(o.sep); diff != "" {
-		return fmt.Sprintf("sep: %v", diff)
+	op, operands := "and", n.and
+	if len(n.or) > 0 {
+		op, operands = "or", n.or
 	}
-	if diff := n.value.diff(o.value); diff != "" {
-		return fmt.Sprintf("value: %v", diff)
+	parts := []string{op}
+	for _, o := range operands {
+		parts = append(parts, o.String())
 	}
-	return ""
-}
-
-func (n *nodeWord) diff(o *nodeWord) string {
-	return n.word.diff(o.word)
+	return "(" + strings.Join(parts, " ") + ")"
 }
 
 func TestParse(t *testing.T) {
 	for i, te := range []struct {
 		tokens []token
-		want   *nodeQuery
+		want   string
 	}{
 		{[]token{
-			{tokenWord, "author"},
-			{tokenColon, ":"},
-			{tokenWord, "foo"},
-		}, &nodeQuery{
-			[]nodeConstraintOrWord{
-				{constraint: &nodeConstraint{
-					key:   token{tokenWord, "author"},
-					sep:   token{tokenColon, ":"},
-					value: token{tokenWord, "foo"},
-				}},
-			},
-		}},
+			tok(tokenWord, "author"),
+			tok(tokenColon, ":"),
+			tok(tokenWord, "foo"),
+		}, "author:foo"},
+		{[]token{
+			tok(tokenColon, ":"),
+			tok(tokenWord, "author"),
+			tok(tokenColon, ":"),
+			tok(tokenWord, "foo"),
+			tok(tokenWord, "bar baz"),
+			tok(tokenWord, "title"),
+			tok(tokenColon, ":"),
+			tok(tokenWord, "foo"),
+			tok(tokenWord, "bar"),
+			tok(tokenWord, "baz"),
+			tok(tokenColon, ":"),
+		}, "(and author:foo bar baz title:foo bar baz)"},
+		// a OR b c OR d
+		{[]token{
+			tok(tokenWord, "a"),
+			tok(tokenOr, "OR"),
+			tok(tokenWord, "b"),
+			tok(tokenWord, "c"),
+			tok(tokenOr, "OR"),
+			tok(tokenWord, "d"),
+		}, "(or a (and b c) d)"},
+		// -(a OR b) AND -c
+		{[]token{
+			tok(tokenMinus, "-"),
+			tok(tokenLParen, "("),
+			tok(tokenWord, "a"),
+			tok(tokenOr, "OR"),
+			tok(tokenWord, "b"),
+			tok(tokenRParen, ")"),
+			tok(tokenAnd, "AND"),
+			tok(tokenMinus, "-"),
+			tok(tokenWord, "c"),
+		}, "(and (not (or a b)) (not c))"},
+		// ) OR a ( ) OR (b (c OR
+		{[]token{
+			tok(tokenRParen, ")"),
+			tok(tokenOr, "OR"),
+			tok(tokenWord, "a"),
+			tok(tokenLParen, "("),
+			tok(tokenRParen, ")"),
+			tok(tokenOr, "OR"),
+			tok(tokenLParen, "("),
+			tok(tokenWord, "b"),
+			tok(tokenLParen, "("),
+			tok(tokenWord, "c"),
+			tok(tokenOr, "OR"),
+		}, "(or a (and b c))"},
+		{[]token{
+			tok(tokenColon, ":"),
+			tok(tokenMinus, "-"),
+		}, "nil"},
+		// priority<=2 -updated>-14d
 		{[]token{
-			{tokenColon, ":"},
-			{tokenWord, "author"},
-			{tokenColon, ":"},
-			{tokenWord, "foo"},
-			{tokenWord, "bar baz"},
-			{tokenWord, "title"},
-			{tokenColon, ":"},
-			{tokenWord, "foo"},
-			{tokenWord, "bar"},
-			{tokenWord, "baz"},
-			{tokenColon, ":"},
-		}, &nodeQuery{
-			[]nodeConstraintOrWord{
-				{constraint: &nodeConstraint{
-					key:   token{tokenWord, "author"},
-					sep:   token{tokenColon, ":"},
-					value: token{tokenWord, "foo"},
-				}},
-				{word: &nodeWord{word: token{tokenWord, "bar baz"}}},
-				{constraint: &nodeConstraint{
-					key:   token{tokenWord, "title"},
-					sep:   token{tokenColon, ":"},
-					value: token{tokenWord, "foo"},
-				}},
-				{word: &nodeWord{word: token{tokenWord, "bar"}}},
-				{word: &nodeWord{word: token{tokenWord, "baz"}}},
-			},
-		}},
+			tok(tokenWord, "priority"),
+			tok(tokenComparison, "<="),
+			tok(tokenWord, "2"),
+			tok(tokenMinus, "-"),
+			tok(tokenWord, "updated"),
+			tok(tokenComparison, ">"),
+			tok(tokenWord, "-14d"),
+		}, "(and priority<=2 (not updated>-14d))"},
 	} {
 		p := &parser{tokens: te.tokens}
 		res := p.parse()
-		if diff := te.want.diff(res); diff != "" {
-			t.Errorf("test %d: %v", i, diff)
+		if want, got := te.want, res.expr.String(); want != got {
+			t.Errorf("test %d: wanted %s, got %s", i, want, got)
 		}
 	}
 }
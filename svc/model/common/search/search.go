@@ -1,42 +1,306 @@
 package search
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	cpb "github.com/q3k/bugless/proto/common"
 )
 
 // Bugless provides a query language for search queries.
 //
-// Currently it's very simplistic, and made up of:
+// A query is a boolean expression of terms, which are either:
 //  - Key/value filters, like "author:q3k"
 //  - Keywords
+// Most key/value filters accept a comma-separated list of values, like
+// "status:new,assigned", and match if any of the values matches.
+// Key/value filters on ordered fields can also be comparisons, like
+// "priority<2" or "updated>=-14d", or inclusive ranges, like "priority:0..1".
+// The special sort key is not a filter, but a directive requesting a given
+// ordering of results, like "sort:-priority,updated" (ie. by descending
+// priority, then by ascending last update time).
+// Terms can be combined with OR, negated by prefixing them with a minus and
+// grouped with parentheses. Terms that follow each other are ANDed together
+// (an explicit AND is also accepted). OR binds weaker than AND.
+//
 // A query like 'author:q3k foo bar "bar foo" status:open' would for example
 // get parsed as 'all issues authored by q3k AND whose status is open AND to be
 // ordered by relevancy according to the keywords 'foo', 'bar' and 'bar foo'.
+// A query like '(status:new OR status:assigned) -assignee:q3k' would get
+// parsed as 'all issues whose status is new or assigned, and that are not
+// assigned to q3k'.
 //
 // Keywords are defined as words that are part of the issue title, body or other fields.
 //
-// TODO(q3k): document this once this stabilizes/evolves.
+// See parse.go for the formal grammar.
 //
-// TODO(q3k): define a formal grammar before doing any more work on this.
+// TODO(q3k): document this once this stabilizes/evolves.
 
 // Query is a parsed, but lightly typed search query from the user. It
 // is the result of a string-based query (like author:q3k foo status:bar).
-// All search string elements that could have been extracted end up in the
-// 'key' fields.
 type Query struct {
-	// Key fields. If set, the query selects that the given key must be set to
-	// its corresponding value.
-	ID       string
-	Author   string
-	Assignee string
-	Status   string
-
-	// All words that are not part of key/value filters.
+	// Expr is the boolean expression of the query, or nil if the query
+	// contains no terms.
+	Expr *Expr
+	// Keywords are the keywords that every result must match, ie. the ones
+	// that are part of the top-level conjunction of the query. These can be
+	// used for relevance ordering.
 	Keywords []string
 	// The original query.
 	OriginalQuery string
+	// Sort is the ordering requested by sort directives, or empty if none.
+	Sort []SortKey
+	// Errors are problems found while parsing the query. The query is still
+	// usable, with the offending parts ignored.
+	Errors []*Error
+}
+
+// SortKey is a key of the ordering requested by a sort directive. Field names
+// are not checked.
+type SortKey struct {
+	// Field is the lowercase name of the field to order by.
+	Field      string
+	Descending bool
+	// Span is the part of the query with the sort directive value.
+	Span Span
+}
+
+// Span is a part of the original query, as byte offsets [Start, End).
+type Span struct {
+	Start, End int
+}
+
+// Severity is how bad a problem found in a query is.
+type Severity int
+
+const (
+	SeverityInvalid Severity = iota
+	// SeverityWarning problems have been worked around, eg. by ignoring a
+	// part of the query that made no sense.
+	SeverityWarning
+	// SeverityError problems make the query return different results than
+	// what the user most likely intended, eg. a filter on an unknown field.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "invalid"
+}
+
+// Error is a problem found in a part of a query.
+type Error struct {
+	Severity Severity
+	// Span is the offending part of the query.
+	Span    Span
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at %d-%d: %s", e.Severity, e.Span.Start, e.Span.End, e.Message)
+}
+
+// Op is the operator of an expression.
+type Op int
+
+const (
+	OpInvalid Op = iota
+	// OpTerm expressions are leaves of the expression tree, ie. a key/value
+	// filter or a keyword.
+	OpTerm
+	// OpAnd expressions match if all of their operands match.
+	OpAnd
+	// OpOr expressions match if any of their operands match.
+	OpOr
+	// OpNot expressions match if their single operand doesn't match.
+	OpNot
+)
+
+// Expr is a node of the boolean expression tree of a query.
+type Expr struct {
+	Op Op
+	// Operands of an OpAnd/OpOr (two or more) or OpNot (exactly one)
+	// expression.
+	Operands []*Expr
+	// Term of an OpTerm expression.
+	Term *Term
+}
+
+// fieldAliases maps alternative names of fields in key/value filters to their
+// canonical names.
+var fieldAliases = map[string]string{
+	"p": "priority",
+}
+
+// Fields are the canonical names of all fields that can be used in key/value
+// terms, roughly in order of how commonly they are used. This includes sort,
+// which is used in sort directives rather than filters.
+var Fields = []string{
+	"status", "assignee", "author", "type", "priority", "is", "category",
+	"cc", "commenter", "has", "title", "created", "updated", "id", "sort",
+}
+
+// Term is a key/value filter or a keyword. Keys are not type checked, and
+// values are passed as given by the user.
+type Term struct {
+	// Key is the lowercase name of the filtered field (with any aliases
+	// resolved to the canonical name of the field), or empty if the term is a
+	// keyword.
+	Key string
+	// Comparison is the predicate of a key/value filter.
+	Comparison Comparison
+	// Value is the value of the filtered field, or the keyword.
+	Value string
+	// KeySpan is the part of the query with the key (empty for keywords),
+	// ValueSpan the one with the value or keyword.
+	KeySpan, ValueSpan Span
+}
+
+// Comparison is the predicate of a key/value filter, ie. how the field is
+// compared to the value.
+type Comparison int
+
+const (
+	// ComparisonEqual is the ':' predicate.
+	ComparisonEqual Comparison = iota
+	ComparisonLess
+	ComparisonLessEqual
+	ComparisonGreater
+	ComparisonGreaterEqual
+)
+
+func (c Comparison) String() string {
+	switch c {
+	case ComparisonEqual:
+		return ":"
+	case ComparisonLess:
+		return "<"
+	case ComparisonLessEqual:
+		return "<="
+	case ComparisonGreater:
+		return ">"
+	case ComparisonGreaterEqual:
+		return ">="
+	}
+	return "?"
+}
+
+// Values returns the values of a key/value filter with a comma-separated list
+// of values, like status:fixed,fixed_verified. Empty values are skipped.
+func (t *Term) Values() []string {
+	var res []string
+	for _, v := range strings.Split(t.Value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Range returns the bounds of a range filter, like priority:0..1. Either
+// bound can be empty if the range is open on that side (like priority:..1).
+// If the term is not a range filter, ok is false.
+func (t *Term) Range() (from, to string, ok bool) {
+	if t.Key == "" || t.Comparison != ComparisonEqual {
+		return "", "", false
+	}
+	parts := strings.SplitN(t.Value, "..", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// String returns a lisp-like representation of the expression, eg.
+// (and author:"q3k" (not "foo")).
+func (e *Expr) String() string {
+	switch e.Op {
+	case OpTerm:
+		if e.Term.Key == "" {
+			return fmt.Sprintf("%q", e.Term.Value)
+		}
+		return fmt.Sprintf("%s%s%q", e.Term.Key, e.Term.Comparison, e.Term.Value)
+	}
+
+	var parts []string
+	switch e.Op {
+	case OpAnd:
+		parts = append(parts, "and")
+	case OpOr:
+		parts = append(parts, "or")
+	case OpNot:
+		parts = append(parts, "not")
+	default:
+		return "invalid"
+	}
+	for _, o := range e.Operands {
+		parts = append(parts, o.String())
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// field returns the canonical name of the field filtered by a constraint.
+func (n *nodeConstraint) field() string {
+	key := strings.ToLower(n.key.content)
+	if alias, ok := fieldAliases[key]; ok {
+		key = alias
+	}
+	return key
+}
+
+// comparison returns the predicate of a constraint.
+func (n *nodeConstraint) comparison() Comparison {
+	switch n.sep.content {
+	case "<":
+		return ComparisonLess
+	case "<=":
+		return ComparisonLessEqual
+	case ">":
+		return ComparisonGreater
+	case ">=":
+		return ComparisonGreaterEqual
+	}
+	return ComparisonEqual
+}
+
+// newExpr converts a parsed expression into an Expr.
+func newExpr(n *nodeExpr) *Expr {
+	switch {
+	case n.constraint != nil:
+		return &Expr{Op: OpTerm, Term: &Term{
+			Key:        n.constraint.field(),
+			Comparison: n.constraint.comparison(),
+			Value:      n.constraint.value.content,
+			KeySpan:    n.constraint.key.span(),
+			ValueSpan:  n.constraint.value.span(),
+		}}
+	case n.word != nil:
+		return &Expr{Op: OpTerm, Term: &Term{
+			Value:     n.word.word.content,
+			ValueSpan: n.word.word.span(),
+		}}
+	case n.not != nil:
+		return &Expr{Op: OpNot, Operands: []*Expr{newExpr(n.not)}}
+	}
+
+	res := &Expr{Op: OpAnd}
+	operands := n.and
+	if len(n.or) > 0 {
+		res.Op = OpOr
+		operands = n.or
+	}
+	for _, o := range operands {
+		res.Operands = append(res.Operands, newExpr(o))
+	}
+	return res
 }
 
 // ParseSearch parses the given string as a search query and returns a Query
@@ -50,30 +314,168 @@ func ParseSearch(s string) *Query {
 	}
 
 	l := lexer{s: s}
-	tokens, _ := l.lex()
+	tokens, terminated := l.lex()
 	p := parser{tokens: tokens}
+	if !terminated {
+		last := tokens[len(tokens)-1]
+		p.warn(last, last, "unterminated quote")
+	}
 	q := p.parse()
+	res.Errors = p.errors
+	if q.expr == nil {
+		return res
+	}
+	res.Expr = res.extractSort(newExpr(q.expr), true)
+	if res.Expr == nil {
+		return res
+	}
 
-	for _, el := range q.elems {
-		if el.constraint != nil {
-			switch strings.ToLower(el.constraint.key.content) {
-			case "id":
-				res.ID = el.constraint.value.content
-			case "author":
-				res.Author = el.constraint.value.content
-			case "assignee":
-				res.Assignee = el.constraint.value.content
-			case "status":
-				res.Status = el.constraint.value.content
-			}
-		}
-		if el.word != nil {
-			res.Keywords = append(res.Keywords, el.word.word.content)
+	top := []*Expr{res.Expr}
+	if res.Expr.Op == OpAnd {
+		top = res.Expr.Operands
+	}
+	for _, e := range top {
+		if e.Op == OpTerm && e.Term.Key == "" {
+			res.Keywords = append(res.Keywords, e.Term.Value)
 		}
 	}
 	return res
 }
 
+// extractSort removes sort directives from an expression, and adds the
+// top-level ones (ie. ones that are not part of an OR or negated) to the
+// query. The resulting expression is returned, or nil if nothing is left.
+func (q *Query) extractSort(e *Expr, top bool) *Expr {
+	switch e.Op {
+	case OpTerm:
+		if e.Term.Key != "sort" {
+			return e
+		}
+		span := Span{e.Term.KeySpan.Start, e.Term.ValueSpan.End}
+		warn := func(message string) {
+			q.Errors = append(q.Errors, &Error{Severity: SeverityWarning, Span: span, Message: message})
+		}
+		switch {
+		case !top:
+			warn("sort cannot be negated or part of an OR, ignored")
+		case e.Term.Comparison != ComparisonEqual:
+			warn(fmt.Sprintf("sort cannot be compared with %s, ignored", e.Term.Comparison))
+		case len(e.Term.Values()) == 0:
+			warn("sort must have a value, ignored")
+		}
+		if !top || e.Term.Comparison != ComparisonEqual {
+			return nil
+		}
+		for _, v := range e.Term.Values() {
+			q.Sort = append(q.Sort, SortKey{
+				Field:      strings.ToLower(strings.TrimSpace(strings.TrimPrefix(v, "-"))),
+				Descending: strings.HasPrefix(v, "-"),
+				Span:       e.Term.ValueSpan,
+			})
+		}
+		return nil
+	case OpOr, OpNot:
+		top = false
+	}
+
+	var operands []*Expr
+	for _, o := range e.Operands {
+		if o = q.extractSort(o, top); o != nil {
+			operands = append(operands, o)
+		}
+	}
+	switch {
+	case len(operands) == 0:
+		return nil
+	case len(operands) == 1 && e.Op != OpNot:
+		return operands[0]
+	}
+	return &Expr{Op: e.Op, Operands: operands}
+}
+
+// ParseDate attempts to parse a human-provided date, relative to a given
+// current time. As dates are usually given with limited precision, the result
+// is the period of time [start, end) described by the date. Supported formats
+// are:
+//  - absolute days, like 2020-06-01 (UTC)
+//  - absolute times in RFC3339 format, like 2020-06-01T12:00:00Z (these need
+//    to be quoted in queries, as they contain colons)
+//  - days, weeks or hours relative to now, like -14d, -2w or -3h, describing
+//    the entire day (UTC) or hour in question
+func ParseDate(s string, now time.Time) (start, end time.Time, ok bool) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, t.AddDate(0, 0, 1), true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, t.Add(time.Nanosecond), true
+	}
+
+	if len(s) < 3 || s[0] != '-' {
+		return
+	}
+	n, err := strconv.ParseUint(s[1:len(s)-1], 10, 16)
+	if err != nil {
+		return
+	}
+	now = now.UTC()
+	switch s[len(s)-1] {
+	case 'h', 'H':
+		start = now.Truncate(time.Hour).Add(-time.Duration(n) * time.Hour)
+		return start, start.Add(time.Hour), true
+	case 'w', 'W':
+		n *= 7
+		fallthrough
+	case 'd', 'D':
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -int(n))
+		return start, start.AddDate(0, 0, 1), true
+	}
+	return
+}
+
+// ParseIssueType attempts to parse a human-provided string into a protobuf
+// issue type. If nothing could be parsed, INVALID is returned.
+func ParseIssueType(s string) cpb.IssueType {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "bug":
+		return cpb.IssueType_BUG
+
+	case "feature":
+		fallthrough
+	case "feature_request":
+		return cpb.IssueType_FEATURE_REQUEST
+
+	case "customer":
+		fallthrough
+	case "customer_issue":
+		return cpb.IssueType_CUSTOMER_ISSUE
+
+	case "cleanup":
+		fallthrough
+	case "internal_cleanup":
+		return cpb.IssueType_INTERNAL_CLEANUP
+
+	case "process":
+		return cpb.IssueType_PROCESS
+
+	case "security":
+		fallthrough
+	case "vulnerability":
+		return cpb.IssueType_VULNERABILITY
+	}
+
+	return cpb.IssueType_ISSUE_TYPE_INVALID
+}
+
+// IssueTypeKeywords are all the values accepted by ParseIssueType, canonical
+// names first.
+var IssueTypeKeywords = []string{
+	"bug", "feature_request", "customer_issue", "internal_cleanup", "process",
+	"vulnerability",
+	"feature", "customer", "cleanup", "security",
+}
+
 // ParseIssueStatus attempts to parse a human-provided string into a protobuf
 // issue status. If nothing could be parsed, INVALID is returned.
 func ParseIssueStatus(s string) cpb.IssueStatus {
@@ -128,3 +530,50 @@ func ParseIssueStatus(s string) cpb.IssueStatus {
 
 	return cpb.IssueStatus_ISSUE_STATUS_INVALID
 }
+
+// IssueStatusKeywords are all the values accepted by ParseIssueStatus,
+// canonical names first.
+var IssueStatusKeywords = []string{
+	"new", "assigned", "accepted", "fixed", "fixed_verified",
+	"wontfix_not_reproducible", "wontfix_intended", "wontfix_obsolete",
+	"wontfix_infeasible", "wontfix_unfortunate", "duplicate",
+	"verified", "not_reproducible", "intended", "obsolete", "infeasible",
+	"unfortunate",
+}
+
+// IssueStatusOpen returns whether an issue with a given status is open, ie. it
+// still needs to be worked on.
+func IssueStatusOpen(s cpb.IssueStatus) bool {
+	switch s {
+	case cpb.IssueStatus_NEW, cpb.IssueStatus_ASSIGNED, cpb.IssueStatus_ACCEPTED:
+		return true
+	}
+	return false
+}
+
+// IssueStatusGroupKeywords are all the values accepted by
+// ParseIssueStatusGroup.
+var IssueStatusGroupKeywords = []string{"open", "closed"}
+
+// ParseIssueStatusGroup attempts to parse a human-provided string (open or
+// closed) into a group of protobuf issue statuses. Every valid status is
+// either open or closed. If nothing could be parsed, nil is returned.
+func ParseIssueStatusGroup(s string) []cpb.IssueStatus {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s != "open" && s != "closed" {
+		return nil
+	}
+
+	var res []cpb.IssueStatus
+	for v := range cpb.IssueStatus_name {
+		st := cpb.IssueStatus(v)
+		if st == cpb.IssueStatus_ISSUE_STATUS_INVALID {
+			continue
+		}
+		if IssueStatusOpen(st) == (s == "open") {
+			res = append(res, st)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
@@ -3,55 +3,258 @@ package search
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	cpb "github.com/q3k/bugless/proto/common"
 )
 
 func (q *Query) diff(o *Query) string {
-	if want, got := q.ID, o.ID; want != got {
-		return fmt.Sprintf("wanted ID %q, got %q", want, got)
-	}
-	if want, got := q.Author, o.Author; want != got {
-		return fmt.Sprintf("wanted Author %q, got %q", want, got)
-	}
-	if want, got := q.Assignee, o.Assignee; want != got {
-		return fmt.Sprintf("wanted Assignee %q, got %q", want, got)
-	}
-	if want, got := q.Status, o.Status; want != got {
-		return fmt.Sprintf("wanted Status %q, got %q", want, got)
+	if want, got := fmt.Sprintf("%v", q.Expr), fmt.Sprintf("%v", o.Expr); want != got {
+		return fmt.Sprintf("wanted Expr %s, got %s", want, got)
 	}
 	if want, got := len(q.Keywords), len(o.Keywords); want != got {
-		return fmt.Sprintf("wanted Keywords %v got %v", want, got)
+		return fmt.Sprintf("wanted Keywords %v got %v", q.Keywords, o.Keywords)
 	}
-	for i, w := range o.Keywords {
+	for i, w := range q.Keywords {
 		g := o.Keywords[i]
 		if w != g {
 			return fmt.Sprintf("keword %d: wanted %q, got %q", i, w, g)
 		}
 	}
+	sortKeys := func(keys []SortKey) string {
+		var res []string
+		for _, k := range keys {
+			res = append(res, fmt.Sprintf("%s/%v", k.Field, k.Descending))
+		}
+		return fmt.Sprintf("%v", res)
+	}
+	if want, got := sortKeys(q.Sort), sortKeys(o.Sort); want != got {
+		return fmt.Sprintf("wanted Sort %s, got %s", want, got)
+	}
 	return ""
 }
 
+func term(key, value string) *Expr {
+	return &Expr{Op: OpTerm, Term: &Term{Key: key, Value: value}}
+}
+
+func cmp(key string, c Comparison, value string) *Expr {
+	return &Expr{Op: OpTerm, Term: &Term{Key: key, Comparison: c, Value: value}}
+}
+
+func op(op Op, operands ...*Expr) *Expr {
+	return &Expr{Op: op, Operands: operands}
+}
+
 func TestParseSearch(t *testing.T) {
 	for i, te := range []struct {
 		s    string
 		want *Query
 	}{
 		{"assignee:q3k status:assigned", &Query{
-			Assignee: "q3k", Status: "assigned",
+			Expr: op(OpAnd, term("assignee", "q3k"), term("status", "assigned")),
+		}},
+		{"cc:implr Author:q3k", &Query{
+			Expr: op(OpAnd, term("cc", "implr"), term("author", "q3k")),
 		}},
 		{"id:1234", &Query{
-			ID: "1234",
+			Expr: term("id", "1234"),
+		}},
+		{"category:hardware/network status:new", &Query{
+			Expr: op(OpAnd, term("category", "hardware/network"), term("status", "new")),
 		}},
 		{"bugless \"bug less\"", &Query{
+			Expr:     op(OpAnd, term("", "bugless"), term("", "bug less")),
 			Keywords: []string{"bugless", "bug less"},
 		}},
 		{"author:\"q3k@q3k.org\" \"foo bar\"", &Query{
-			Author:   "q3k@q3k.org",
+			Expr:     op(OpAnd, term("author", "q3k@q3k.org"), term("", "foo bar")),
 			Keywords: []string{"foo bar"},
 		}},
+		{"foo", &Query{
+			Expr:     term("", "foo"),
+			Keywords: []string{"foo"},
+		}},
+		// Only top-level keywords are required to match.
+		{"(status:new OR status:assigned OR foo) -assignee:q3k -bar baz", &Query{
+			Expr: op(OpAnd,
+				op(OpOr, term("status", "new"), term("status", "assigned"), term("", "foo")),
+				op(OpNot, term("assignee", "q3k")),
+				op(OpNot, term("", "bar")),
+				term("", "baz"),
+			),
+			Keywords: []string{"baz"},
+		}},
+		{": ( )", &Query{}},
+		{"priority<2 created>=2020-06-01 updated<-14d priority:0..1", &Query{
+			Expr: op(OpAnd,
+				cmp("priority", ComparisonLess, "2"),
+				cmp("created", ComparisonGreaterEqual, "2020-06-01"),
+				cmp("updated", ComparisonLess, "-14d"),
+				term("priority", "0..1"),
+			),
+		}},
+		{"P:1 type:bug", &Query{
+			Expr: op(OpAnd, term("priority", "1"), term("type", "bug")),
+		}},
+		{"sort:-priority,Updated foo", &Query{
+			Expr:     term("", "foo"),
+			Keywords: []string{"foo"},
+			Sort:     []SortKey{{Field: "priority", Descending: true}, {Field: "updated"}},
+		}},
+		{"(a OR sort:title) -sort:created b sort:created", &Query{
+			Expr:     op(OpAnd, term("", "a"), term("", "b")),
+			Keywords: []string{"a", "b"},
+			Sort:     []SortKey{{Field: "created"}},
+		}},
+		{"sort:title", &Query{
+			Sort: []SortKey{{Field: "title"}},
+		}},
 	} {
 		got := ParseSearch(te.s)
 		if diff := te.want.diff(got); diff != "" {
-			fmt.Errorf("test %d: %v", i, diff)
+			t.Errorf("test %d: %v", i, diff)
+		}
+	}
+}
+
+func TestTermRange(t *testing.T) {
+	for i, te := range []struct {
+		term     Term
+		from, to string
+		ok       bool
+	}{
+		{Term{Key: "priority", Value: "0..1"}, "0", "1", true},
+		{Term{Key: "priority", Value: "..1"}, "", "1", true},
+		{Term{Key: "created", Value: "2020-06-01.."}, "2020-06-01", "", true},
+		{Term{Key: "priority", Value: "1"}, "", "", false},
+		{Term{Key: "priority", Comparison: ComparisonLess, Value: "0..1"}, "", "", false},
+		{Term{Value: "0..1"}, "", "", false},
+	} {
+		from, to, ok := te.term.Range()
+		if from != te.from || to != te.to || ok != te.ok {
+			t.Errorf("test %d: wanted %q, %q, %v, got %q, %q, %v", i, te.from, te.to, te.ok, from, to, ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2020, 6, 15, 13, 37, 0, 0, time.UTC)
+	for i, te := range []struct {
+		s          string
+		start, end string
+	}{
+		{"2020-06-01", "2020-06-01T00:00:00Z", "2020-06-02T00:00:00Z"},
+		{"2020-06-01T12:00:00+02:00", "2020-06-01T12:00:00+02:00", "2020-06-01T12:00:00.000000001+02:00"},
+		{"-0d", "2020-06-15T00:00:00Z", "2020-06-16T00:00:00Z"},
+		{"-14d", "2020-06-01T00:00:00Z", "2020-06-02T00:00:00Z"},
+		{"-2W", "2020-06-01T00:00:00Z", "2020-06-02T00:00:00Z"},
+		{"-3h", "2020-06-15T10:00:00Z", "2020-06-15T11:00:00Z"},
+		{"14d", "", ""},
+		{"-d", "", ""},
+		{"-1y", "", ""},
+		{"2020-13-01", "", ""},
+	} {
+		start, end, ok := ParseDate(te.s, now)
+		if te.start == "" {
+			if ok {
+				t.Errorf("test %d: %q should not have parsed", i, te.s)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("test %d: %q should have parsed", i, te.s)
+			continue
+		}
+		if want, got := te.start, start.Format(time.RFC3339Nano); want != got {
+			t.Errorf("test %d: wanted start %s, got %s", i, want, got)
+		}
+		if want, got := te.end, end.Format(time.RFC3339Nano); want != got {
+			t.Errorf("test %d: wanted end %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestTermValues(t *testing.T) {
+	for i, te := range []struct {
+		value string
+		want  []string
+	}{
+		{"fixed", []string{"fixed"}},
+		{"fixed,fixed_verified", []string{"fixed", "fixed_verified"}},
+		{"q3k, implr,,", []string{"q3k", "implr"}},
+		{",", nil},
+	} {
+		got := (&Term{Key: "status", Value: te.value}).Values()
+		if want, got := fmt.Sprintf("%q", te.want), fmt.Sprintf("%q", got); want != got {
+			t.Errorf("test %d: wanted %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestParseIssueStatusGroup(t *testing.T) {
+	open := ParseIssueStatusGroup("open")
+	if want, got := "[NEW ASSIGNED ACCEPTED]", fmt.Sprintf("%v", open); want != got {
+		t.Errorf("open: wanted %s, got %s", want, got)
+	}
+	closed := ParseIssueStatusGroup("Closed")
+	if want, got := len(cpb.IssueStatus_name)-1-len(open), len(closed); want != got {
+		t.Errorf("closed: wanted %d statuses, got %d", want, got)
+	}
+	for _, st := range closed {
+		if IssueStatusOpen(st) {
+			t.Errorf("closed: contains open status %v", st)
+		}
+	}
+	if got := ParseIssueStatusGroup("new"); got != nil {
+		t.Errorf("new: wanted nil, got %v", got)
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	for i, te := range []struct {
+		s    string
+		want []string
+	}{
+		{"author:q3k foo", nil},
+		{`foo "bar`, []string{`warning at 4-8: unterminated quote`}},
+		{"foo :", []string{`warning at 4-5: dangling ':' (not part of a key:value filter), ignored`}},
+		{"foo) bar", []string{`warning at 3-4: unmatched ')', ignored`}},
+		{"(foo bar", []string{`warning at 0-1: missing ')'`}},
+		{"foo () bar", []string{`warning at 4-6: empty group, ignored`}},
+		{"OR foo", []string{`warning at 0-2: OR is missing an operand, ignored`}},
+		{"foo OR", []string{`warning at 4-6: OR is missing an operand, ignored`}},
+		{"foo AND", []string{`warning at 4-7: AND is missing an operand, ignored`}},
+		{"-(foo", []string{`warning at 1-2: missing ')'`}},
+		{"-() foo", []string{`warning at 1-3: empty group, ignored`, `warning at 0-1: nothing to negate, ignored`}},
+		{"foo -sort:title", []string{`warning at 5-15: sort cannot be negated or part of an OR, ignored`}},
+		{"foo sort<title", []string{`warning at 4-14: sort cannot be compared with <, ignored`}},
+	} {
+		q := ParseSearch(te.s)
+		var got []string
+		for _, e := range q.Errors {
+			got = append(got, e.Error())
+		}
+		if want, got := fmt.Sprintf("%q", te.want), fmt.Sprintf("%q", got); want != got {
+			t.Errorf("test %d: wanted errors %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	for _, k := range IssueStatusKeywords {
+		if ParseIssueStatus(k) == cpb.IssueStatus_ISSUE_STATUS_INVALID {
+			t.Errorf("status keyword %q does not parse", k)
+		}
+	}
+	for _, k := range IssueTypeKeywords {
+		if ParseIssueType(k) == cpb.IssueType_ISSUE_TYPE_INVALID {
+			t.Errorf("type keyword %q does not parse", k)
+		}
+	}
+	for _, k := range IssueStatusGroupKeywords {
+		if ParseIssueStatusGroup(k) == nil {
+			t.Errorf("status group keyword %q does not parse", k)
 		}
 	}
 }
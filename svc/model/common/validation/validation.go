@@ -2,6 +2,7 @@ package validation
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	cpb "github.com/q3k/bugless/proto/common"
@@ -26,7 +27,7 @@ func NewIssue(req *spb.ModelNewIssueRequest) error {
 	}
 	for i, u := range s.Cc {
 		if err := User(u); err != nil {
-			return fmt.Errorf("assignee[%d]: %w", i, err)
+			return fmt.Errorf("cc[%d]: %w", i, err)
 		}
 	}
 	if err := IssueType(s.Type); err != nil {
@@ -38,22 +39,75 @@ func NewIssue(req *spb.ModelNewIssueRequest) error {
 	if err := IssueStatus(s.Status); err != nil {
 		return fmt.Errorf("status: %w", err)
 	}
+	if s.Category != nil {
+		if err := Category(s.Category); err != nil {
+			return fmt.Errorf("category: %w", err)
+		}
+	}
 	return nil
 }
 
+// User validates and normalizes a user reference from a request. Either the
+// ID or the username must be set, see common.User. This does not check
+// whether the user actually exists.
 func User(u *cpb.User) error {
 	if u == nil {
 		return fmt.Errorf("must be set")
 	}
 	// TODO(q3k): decide how opaque this actually is.
 	u.Id = strings.TrimSpace(strings.ToLower(u.Id))
-	if len(u.Id) > 64 {
+	if u.Id != "" {
+		if len(u.Id) > 64 {
+			return fmt.Errorf("id must be shorter than 64 characters")
+		}
+		return nil
+	}
+	if u.Username == "" {
+		return fmt.Errorf("id or username must be set")
+	}
+	if err := Username(&u.Username); err != nil {
+		return fmt.Errorf("username: %w", err)
+	}
+	// TODO: validate with authn
+	return nil
+}
+
+var reUsername = regexp.MustCompile(`^[a-z0-9\-_@.+]+$`)
+
+// Username validates and normalizes the username of a new user.
+func Username(u *string) error {
+	*u = strings.TrimSpace(strings.ToLower(*u))
+	if len(*u) > 64 {
 		return fmt.Errorf("must be shorter than 64 characters")
 	}
-	if len(u.Id) < 1 {
+	if len(*u) < 1 {
 		return fmt.Errorf("must be at least one character")
 	}
-	// TODO: validate with authn
+	if !reUsername.MatchString(*u) {
+		return fmt.Errorf("must only contain a-z, 0-9, and any of -_@.+")
+	}
+	return nil
+}
+
+var reUserID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// UserID validates and normalizes the ID of an existing user, which is a
+// UUID.
+func UserID(id *string) error {
+	*id = strings.TrimSpace(strings.ToLower(*id))
+	if !reUserID.MatchString(*id) {
+		return fmt.Errorf("must be a UUID")
+	}
+	return nil
+}
+
+func Category(c *cpb.Category) error {
+	if c == nil {
+		return fmt.Errorf("must be set")
+	}
+	if c.Id == "" {
+		return fmt.Errorf("id must be set")
+	}
 	return nil
 }
 
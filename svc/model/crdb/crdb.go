@@ -5,22 +5,31 @@ package main
 
 import (
 	"flag"
+	"time"
 
 	"code.hackerspace.pl/hscloud/go/mirko"
+	"code.hackerspace.pl/hscloud/go/pki"
 	spb "github.com/q3k/bugless/proto/svc"
 	"github.com/q3k/bugless/svc/model/crdb/service"
 
 	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
 )
 
 var (
-	flagEatMyData bool
-	flagDSN       string
+	flagEatMyData          bool
+	flagDSN                string
+	flagAutoProvisionUsers bool
+	flagLivePollInterval   time.Duration
+	flagSearch             string
 )
 
 func main() {
 	flag.BoolVar(&flagEatMyData, "eat_my_data", false, "Run crdb model again an in-memory database. This will be cleared on shutdown, use this for development purposes only")
 	flag.StringVar(&flagDSN, "dsn", "", "DSN, like cockroach://user@host:port/database?sslmode=require&sslrootcert=...")
+	flag.BoolVar(&flagAutoProvisionUsers, "auto_provision_users", false, "Create users that author requests by username but do not exist yet. Use this if users are managed by an external IdP")
+	flag.DurationVar(&flagLivePollInterval, "live_poll_interval", 2*time.Second, "How often live issue update streams poll the database for updates committed by other replicas")
+	flag.StringVar(&flagSearch, "search", "", "Address of bugless search service. If not set, keyword search is disabled")
 	flag.Parse()
 	m := mirko.New()
 	l := log.New()
@@ -35,11 +44,25 @@ func main() {
 	var s *service.Service
 	var err error
 
+	opts := service.Options{
+		AutoProvisionUsers: flagAutoProvisionUsers,
+		LivePollInterval:   flagLivePollInterval,
+	}
+	if flagSearch != "" {
+		conn, err := grpc.Dial(flagSearch, pki.WithClientHSPKI())
+		if err != nil {
+			l.Crit("could not dial search", "err", err)
+			return
+		}
+		opts.Search = spb.NewSearchClient(conn)
+	} else {
+		l.Warn("No search service configured, keyword search disabled")
+	}
 	if flagEatMyData {
 		l.Warn("Running with in-memory database. This WILL EAT YOUR DATA")
-		s, err = service.NewInMemory(ctx, l)
+		s, err = service.NewInMemory(ctx, opts, l)
 	} else {
-		s, err = service.NewDSN(ctx, flagDSN, true, l)
+		s, err = service.NewDSN(ctx, flagDSN, true, opts, l)
 	}
 	if err != nil {
 		l.Crit("creating service failed", "err", err)
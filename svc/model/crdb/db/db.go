@@ -7,6 +7,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"code.hackerspace.pl/hscloud/go/mirko"
@@ -135,3 +136,24 @@ func (s *session) Issue() IssueGetter {
 func (s *session) User() UserGetter {
 	return s.user
 }
+
+// inList appends values to a list of query parameters, and returns a
+// parenthesized list of placeholders referring to them, for use within an IN
+// clause.
+func inList(parameters []interface{}, values ...string) ([]interface{}, string) {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		parameters = append(parameters, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(parameters))
+	}
+	return parameters, "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// inListInt64 is like inList, but for int64 values.
+func inListInt64(parameters []interface{}, values ...int64) ([]interface{}, string) {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = strconv.FormatInt(v, 10)
+	}
+	return inList(parameters, strs...)
+}
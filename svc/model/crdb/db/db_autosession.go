@@ -64,6 +64,16 @@ func (c *autoSessionCategory) GetTree(uuid string, levels uint) (*CategoryNode,
 	return res, s.Commit()
 }
 
+func (c *autoSessionCategory) ResolvePath(path []string) (*Category, error) {
+	s := c.db.Begin(c.ctx)
+	res, err := s.Category().ResolvePath(path)
+	if err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return res, s.Commit()
+}
+
 func (c *autoSessionCategory) New(new *Category) (*Category, error) {
 	s := c.db.Begin(c.ctx)
 	res, err := s.Category().New(new)
@@ -104,7 +114,7 @@ func (c *autoSessionIssue) Get(id int64) (*Issue, error) {
 	return issue, s.Commit()
 }
 
-func (c *autoSessionIssue) Filter(filter IssueFilter, order IssueOrderBy, opts *IssueFilterOpts) ([]*Issue, error) {
+func (c *autoSessionIssue) Filter(filter IssueFilter, order []IssueOrderBy, opts *IssueFilterOpts) ([]*Issue, error) {
 	s := c.db.Begin(c.ctx)
 	issues, err := s.Issue().Filter(filter, order, opts)
 	if err != nil {
@@ -114,6 +124,26 @@ func (c *autoSessionIssue) Filter(filter IssueFilter, order IssueOrderBy, opts *
 	return issues, s.Commit()
 }
 
+func (c *autoSessionIssue) Count(filter IssueFilter) (int64, error) {
+	s := c.db.Begin(c.ctx)
+	count, err := s.Issue().Count(filter)
+	if err != nil {
+		s.Rollback()
+		return 0, err
+	}
+	return count, s.Commit()
+}
+
+func (c *autoSessionIssue) CountBy(filter IssueFilter, facet IssueFacet, limit int64) ([]*IssueFacetCount, error) {
+	s := c.db.Begin(c.ctx)
+	counts, err := s.Issue().CountBy(filter, facet, limit)
+	if err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return counts, s.Commit()
+}
+
 func (c *autoSessionIssue) GetHistory(id int64, opts *IssueGetHistoryOpts) ([]*IssueUpdate, error) {
 	s := c.db.Begin(c.ctx)
 	issue, err := s.Issue().GetHistory(id, opts)
@@ -124,6 +154,16 @@ func (c *autoSessionIssue) GetHistory(id int64, opts *IssueGetHistoryOpts) ([]*I
 	return issue, s.Commit()
 }
 
+func (c *autoSessionIssue) GetChanges(after *IssueChangePosition, count int64) ([]*IssueChange, error) {
+	s := c.db.Begin(c.ctx)
+	changes, err := s.Issue().GetChanges(after, count)
+	if err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return changes, s.Commit()
+}
+
 func (c *autoSessionIssue) New(new *Issue) (*Issue, error) {
 	s := c.db.Begin(c.ctx)
 	issue, err := s.Issue().New(new)
@@ -173,3 +213,43 @@ func (c *autoSessionUser) Get(id string) (*User, error) {
 	}
 	return user, s.Commit()
 }
+
+func (c *autoSessionUser) GetMany(uuids []string) ([]*User, error) {
+	s := c.db.Begin(c.ctx)
+	users, err := s.User().GetMany(uuids)
+	if err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return users, s.Commit()
+}
+
+func (c *autoSessionUser) GetManyByUsername(usernames []string) ([]*User, error) {
+	s := c.db.Begin(c.ctx)
+	users, err := s.User().GetManyByUsername(usernames)
+	if err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return users, s.Commit()
+}
+
+func (c *autoSessionUser) GetByUsernamePrefix(prefix string, count int64) ([]*User, error) {
+	s := c.db.Begin(c.ctx)
+	users, err := s.User().GetByUsernamePrefix(prefix, count)
+	if err != nil {
+		s.Rollback()
+		return nil, err
+	}
+	return users, s.Commit()
+}
+
+func (c *autoSessionUser) Update(u *User) error {
+	s := c.db.Begin(c.ctx)
+	err := s.User().Update(u)
+	if err != nil {
+		s.Rollback()
+		return err
+	}
+	return s.Commit()
+}
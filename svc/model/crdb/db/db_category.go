@@ -4,6 +4,8 @@
 package db
 
 import (
+	cpb "github.com/q3k/bugless/proto/common"
+
 	_ "github.com/golang-migrate/migrate/v4/database/cockroachdb"
 	"github.com/inconshreveable/log15"
 	_ "github.com/lib/pq"
@@ -19,11 +21,16 @@ var (
 	CategoryErrorNotFound         = status.Error(codes.NotFound, "category not found")
 	CategoryErrorCannotDeleteRoot = status.Error(codes.InvalidArgument, "cannot delete root category")
 	CategoryErrorNotEmpty         = status.Error(codes.FailedPrecondition, "category has dependent data")
+	CategoryErrorCycle            = status.Error(codes.InvalidArgument, "category cannot be moved under itself or its descendants")
 )
 
 // The UUID of the root of the category tree.
 const RootCategory = "00000000-0000-0000-0000-000000000000"
 
+// CategoryTreeAllLevels can be passed to GetTree to retrieve all levels of a
+// category tree.
+const CategoryTreeAllLevels = ^uint(0)
+
 // An issue category.
 type Category struct {
 	UUID       string `db:"id"`
@@ -33,6 +40,15 @@ type Category struct {
 	Description string `db:"description"`
 }
 
+func (c *Category) Proto() *cpb.Category {
+	return &cpb.Category{
+		Id:          c.UUID,
+		ParentId:    c.ParentUUID,
+		Name:        c.Name,
+		Description: c.Description,
+	}
+}
+
 // A category that's part of a retrieved category tree.
 type CategoryNode struct {
 	*Category
@@ -40,6 +56,25 @@ type CategoryNode struct {
 	Children []*CategoryNode
 }
 
+// Proto returns the proto representation of the category node, including all
+// of its retrieved children.
+func (n *CategoryNode) Proto() *cpb.Category {
+	p := n.Category.Proto()
+	for _, child := range n.Children {
+		p.Children = append(p.Children, child.Proto())
+	}
+	return p
+}
+
+// UUIDs returns the UUIDs of this category and all its retrieved descendants.
+func (n *CategoryNode) UUIDs() []string {
+	res := []string{n.UUID}
+	for _, child := range n.Children {
+		res = append(res, child.UUIDs()...)
+	}
+	return res
+}
+
 type CategoryGetter interface {
 	// Get retrieves a database category by UUID.
 	Get(uuid string) (*Category, error)
@@ -49,13 +84,18 @@ type CategoryGetter interface {
 	// node, level 1 the node and its children, level 2 the node, it's children
 	// and it's grandchildren, etc.
 	GetTree(rootUUID string, levels uint) (*CategoryNode, error)
+	// ResolvePath retrieves a category by a path of category names, starting
+	// from the root category (which is not part of the path). Names are
+	// matched case-insensitively.
+	ResolvePath(path []string) (*Category, error)
 	// New creates a new database category from an in-memroy category.  UUID
 	// must be unset. ParentUUID should either point to an existing category
 	// (if the category is a chuild category) or be blank (if the category
 	// should be to-level).
 	New(new *Category) (*Category, error)
 	// Update saves a given category. All fields can be updated apart from the
-	// current UUID.
+	// current UUID. A category cannot be moved under itself or any of its
+	// descendants.
 	Update(cat *Category) error
 	// Delete removes a category. It must not contain any child categories or
 	// issues.
@@ -164,6 +204,45 @@ func (d *databaseCategory) GetTree(rootUUID string, levels uint) (*CategoryNode,
 	return elems[rootUUID], nil
 }
 
+func (d *databaseCategory) ResolvePath(path []string) (*Category, error) {
+	cur, err := d.Get(RootCategory)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+		SELECT
+			categories.id AS id,
+			categories.parent_id AS parent_id,
+			categories.name AS name,
+			categories.description AS description
+		FROM
+			categories
+		WHERE
+			parent_id = $1
+			AND lower(name) = lower($2)
+	`
+	for _, name := range path {
+		data := []*Category{}
+		err := d.tx.SelectContext(d.ctx, &data, q, cur.UUID, name)
+		if err != nil {
+			return nil, NewErrorConverter().Convert(err)
+		}
+		// Names are only unique when compared case-sensitively, so there
+		// could be more than one match. Prefer an exact one, if present.
+		if len(data) == 0 {
+			return nil, CategoryErrorNotFound
+		}
+		cur = data[0]
+		for _, datum := range data {
+			if datum.Name == name {
+				cur = datum
+			}
+		}
+	}
+	return cur, nil
+}
+
 func (d *databaseCategory) New(new *Category) (*Category, error) {
 	if new.UUID != "" {
 		return nil, status.Error(codes.InvalidArgument, "category cannot contain preset UUID")
@@ -250,6 +329,23 @@ func (d *databaseCategory) Update(cat *Category) error {
 		WithForeignKeyViolation(CategoryErrorParentNotFound).
 		WithUniqueConstraintViolation(CategoryErrorDuplicateName)
 
+	// Walk up from the new parent to the root of the tree, ensuring we don't
+	// encounter the updated category on the way. Otherwise, the category and
+	// its descendants would become detached from the root.
+	for parent := cat.ParentUUID; parent != ""; {
+		if parent == cat.UUID {
+			return CategoryErrorCycle
+		}
+		p, err := d.Get(parent)
+		if err != nil {
+			if err == CategoryErrorNotFound {
+				return CategoryErrorParentNotFound
+			}
+			return err
+		}
+		parent = p.ParentUUID
+	}
+
 	q := `
 		UPDATE categories
 		SET
@@ -260,8 +356,14 @@ func (d *databaseCategory) Update(cat *Category) error {
 			id = :id
 	`
 
-	_, err := d.tx.NamedExecContext(d.ctx, q, &cat)
-	return conv.Convert(err)
+	res, err := d.tx.NamedExecContext(d.ctx, q, cat)
+	if err != nil {
+		return conv.Convert(err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return CategoryErrorNotFound
+	}
+	return nil
 }
 
 func (d *databaseCategory) Delete(uuid string) error {
@@ -202,6 +202,14 @@ func TestCategoriesCRUD(t *testing.T) {
 		t.Fatalf("Category.Delete(root): wanted %q, got %q", want, got)
 	}
 
+	// Check moving a category under its own descendant
+	testCat.ParentUUID = testCat2.UUID
+	err = s.Category().Update(testCat)
+	if want, got := CategoryErrorCycle, err; want != got {
+		t.Fatalf("Category.Update(cycle): wanted %q, got %q", want, got)
+	}
+	testCat.ParentUUID = RootCategory
+
 	// Check removing a non-leaf category
 	err = s.Category().Delete(testCat.UUID)
 	if want, got := CategoryErrorNotEmpty, err; want != got {
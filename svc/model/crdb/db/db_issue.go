@@ -6,6 +6,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,6 +38,14 @@ type Issue struct {
 	Type       int64  `db:"type"`
 	Priority   int64  `db:"priority"`
 	Status     int64  `db:"status"`
+	CategoryID string `db:"category_id"`
+
+	// CC list, stored in issue_cc_lists.
+	CCIDs []string `db:"-"`
+
+	// Username of the assignee, only retrieved by Filter (as it's used for
+	// ordering).
+	AssigneeUsername string `db:"assignee_username"`
 }
 
 func (i *Issue) Proto() *cpb.Issue {
@@ -44,6 +53,10 @@ func (i *Issue) Proto() *cpb.Issue {
 	if assignee.Id == UnassignedUUID {
 		assignee = nil
 	}
+	var cc []*cpb.User
+	for _, id := range i.CCIDs {
+		cc = append(cc, &cpb.User{Id: id})
+	}
 	return &cpb.Issue{
 		Id:      i.ID,
 		Created: &cpb.Timestamp{Nanos: i.Created},
@@ -52,9 +65,10 @@ func (i *Issue) Proto() *cpb.Issue {
 			Title:    i.Title,
 			Assignee: assignee,
 			Type:     cpb.IssueType(i.Type),
-			// TODO(q3k): return CC list
+			Cc:       cc,
 			Priority: i.Priority,
 			Status:   cpb.IssueStatus(i.Status),
+			Category: &cpb.Category{Id: i.CategoryID},
 		},
 		LastUpdated: &cpb.Timestamp{Nanos: i.LastUpdated},
 	}
@@ -77,10 +91,45 @@ func (i *Issue) ProtoWithUsers(s Session) (*cpb.Issue, error) {
 		}
 		p.Current.Assignee = assignee.Proto()
 	}
+	if err := protoUsers(s, p.Current.Cc); err != nil {
+		return p, err
+	}
 
 	return p, nil
 }
 
+// protoUsers fills in full user data for users that only have their ID set,
+// looking all of them up with a single query.
+func protoUsers(s Session, lists ...[]*cpb.User) error {
+	var ids []string
+	for _, users := range lists {
+		for _, u := range users {
+			ids = append(ids, u.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	found, err := s.User().GetMany(ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*User)
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+	for _, users := range lists {
+		for _, u := range users {
+			user, ok := byID[u.Id]
+			if !ok {
+				return UserErrorNoSuchUser
+			}
+			u.Username = user.Username
+		}
+	}
+	return nil
+}
+
 type IssueUpdate struct {
 	IssueID  int64          `db:"issue_id"`
 	UpdateID int64          `db:"id"`
@@ -93,10 +142,16 @@ type IssueUpdate struct {
 	Type       sql.NullInt64  `db:"type"`
 	Priority   sql.NullInt64  `db:"priority"`
 	Status     sql.NullInt64  `db:"status"`
+	CategoryID sql.NullString `db:"category_id"`
+
+	// CC list changes, stored in issue_update_cc_lists.
+	CCAddedIDs   []string `db:"-"`
+	CCRemovedIDs []string `db:"-"`
 }
 
 func (u *IssueUpdate) Proto() *cpb.Update {
 	update := &cpb.Update{
+		Id:      u.UpdateID,
 		Created: &cpb.Timestamp{Nanos: u.Created},
 		Author:  &cpb.User{Id: u.AuthorID},
 		Comment: u.Comment.String,
@@ -122,6 +177,15 @@ func (u *IssueUpdate) Proto() *cpb.Update {
 	if u.Status.Valid {
 		update.Diff.Status = cpb.IssueStatus(u.Status.Int64)
 	}
+	if u.CategoryID.Valid {
+		update.Diff.Category = &cpb.Category{Id: u.CategoryID.String}
+	}
+	for _, id := range u.CCAddedIDs {
+		update.Diff.CcAdded = append(update.Diff.CcAdded, &cpb.User{Id: id})
+	}
+	for _, id := range u.CCRemovedIDs {
+		update.Diff.CcRemoved = append(update.Diff.CcRemoved, &cpb.User{Id: id})
+	}
 
 	return update
 }
@@ -140,6 +204,9 @@ func (u *IssueUpdate) ProtoWithUsers(s Session) (*cpb.Update, error) {
 		}
 		p.Diff.Assignee.Value = assignee.Proto()
 	}
+	if err := protoUsers(s, p.Diff.CcAdded, p.Diff.CcRemoved); err != nil {
+		return p, err
+	}
 
 	return p, nil
 }
@@ -147,36 +214,224 @@ func (u *IssueUpdate) ProtoWithUsers(s Session) (*cpb.Update, error) {
 type IssueGetHistoryOpts struct {
 	Start int64
 	Count int64
+	// Reverse retrieves updates in reverse order, ie. the ones preceding
+	// Start (if set), latest first.
+	Reverse bool
 }
 
 type IssueFilter struct {
-	// The filter passes when all the set fields match an issue.
-	Author   string
-	Assignee string
-	Status   int64
+	// The filter passes when all the set fields match an issue. An empty
+	// filter passes all issues. Fields with lists of values pass if the issue
+	// matches any of the values.
+	Authors   []string
+	Assignees []string
+	// CCs passes if any of the given users is on the issue's CC list.
+	CCs []string
+	// Commenters passes if any of the given users has commented on the issue.
+	Commenters []string
+	Statuses   []int64
+	Types      []int64
+	// Title passes if the issue's title contains the given string, ignoring
+	// case.
+	Title string
+	// Assigned passes if the issue has an assignee.
+	Assigned bool
+	// Categories passes if the issue belongs to any of the given categories.
+	Categories []string
+	// IDs passes if the issue is any of the given issues.
+	IDs []int64
+	// Priority, Created and Updated pass if the issue's priority, creation
+	// and last update timestamp are within the given ranges.
+	Priority IssueRange
+	Created  IssueRange
+	Updated  IssueRange
+
+	// And passes if all of the given filters pass.
+	And []IssueFilter
+	// Or passes if any of the given filters pass.
+	Or []IssueFilter
+	// Not passes if the given filter does not pass.
+	Not *IssueFilter
+}
+
+// IssueRange is a range of int64 issue field values [Min, Max). Both bounds
+// are optional.
+type IssueRange struct {
+	// Min is the inclusive lower bound of the range, if valid.
+	Min sql.NullInt64
+	// Max is the exclusive upper bound of the range, if valid.
+	Max sql.NullInt64
 }
 
+// IssueOrderBy is a key of an ordering of issues.
 type IssueOrderBy struct {
 	Ascending bool
 	By        IssueOrder
 }
 
+// IssueOrder is a field by which issues can be ordered.
 type IssueOrder int
 
 const (
 	IssueOrderCreated IssueOrder = iota
 	IssueOrderUpdated
+	IssueOrderPriority
+	IssueOrderStatus
+	IssueOrderType
+	// IssueOrderAssignee orders by assignee username, unassigned first.
+	IssueOrderAssignee
+	IssueOrderTitle
+
+	// issueOrderID orders by issue ID. It's implicitly the last key of every
+	// ordering.
+	issueOrderID IssueOrder = -1
 )
 
+// column returns the SQL expression of the ordered field in Filter, or an
+// empty string if the order is invalid.
+func (o IssueOrder) column() string {
+	switch o {
+	case issueOrderID:
+		return "issues.id"
+	case IssueOrderCreated:
+		return "issues.created"
+	case IssueOrderUpdated:
+		return "issues.last_updated"
+	case IssueOrderPriority:
+		return "issues.priority"
+	case IssueOrderStatus:
+		return "issues.status"
+	case IssueOrderType:
+		return `issues."type"`
+	case IssueOrderAssignee:
+		return "assignees.username"
+	case IssueOrderTitle:
+		return "issues.title"
+	}
+	return ""
+}
+
+// value returns the value of the ordered field of an issue, either an int64 or
+// a string.
+func (o IssueOrder) value(i *Issue) interface{} {
+	switch o {
+	case issueOrderID:
+		return i.ID
+	case IssueOrderCreated:
+		return i.Created
+	case IssueOrderUpdated:
+		return i.LastUpdated
+	case IssueOrderPriority:
+		return i.Priority
+	case IssueOrderStatus:
+		return i.Status
+	case IssueOrderType:
+		return i.Type
+	case IssueOrderAssignee:
+		return i.AssigneeUsername
+	case IssueOrderTitle:
+		return i.Title
+	}
+	return nil
+}
+
+// IssuePosition is the position of an issue within an ordering: the values of
+// its ordered fields, followed by its ID.
+type IssuePosition struct {
+	Key []interface{}
+	ID  int64
+}
+
+// Position returns the position of the issue within an ordering.
+func (i *Issue) Position(order []IssueOrderBy) *IssuePosition {
+	p := &IssuePosition{ID: i.ID}
+	for _, o := range order {
+		p.Key = append(p.Key, o.By.value(i))
+	}
+	return p
+}
+
 type IssueFilterOpts struct {
-	Start int64
+	// After is the position of the last issue of the previous page, if any.
+	// It must have been retrieved with the same ordering.
+	After *IssuePosition
 	Count int64
+	// Reverse retrieves issues in reverse order, ie. the ones preceding After
+	// (if set), closest first.
+	Reverse bool
+}
+
+// IssueFacet is a field by which issues can be counted.
+type IssueFacet int
+
+const (
+	IssueFacetStatus IssueFacet = iota
+	IssueFacetType
+	IssueFacetPriority
+	// IssueFacetAssignee counts by assignee UUID, with unassigned issues
+	// counted under UnassignedUUID.
+	IssueFacetAssignee
+	IssueFacetCategory
+)
+
+// column returns the SQL expression of the counted field in CountBy, or an
+// empty string if the facet is invalid.
+func (f IssueFacet) column() string {
+	switch f {
+	case IssueFacetStatus:
+		return "issues.status"
+	case IssueFacetType:
+		return `issues."type"`
+	case IssueFacetPriority:
+		return "issues.priority"
+	case IssueFacetAssignee:
+		return "issues.assignee_id"
+	case IssueFacetCategory:
+		return "issues.category_id"
+	}
+	return ""
+}
+
+// IssueFacetCount is the amount of issues with a given value of a field.
+type IssueFacetCount struct {
+	// Value of the field, formatted as a string (eg. a decimal number for
+	// statuses, or a UUID for assignees).
+	Value string `db:"value"`
+	Count int64  `db:"count"`
+}
+
+// IssueChangePosition is the position of a change in the global, commit
+// ordered feed of changes to issues.
+type IssueChangePosition struct {
+	// Commit timestamp of the change, as a decimal string.
+	CommitTS string `db:"commit_ts"`
+	IssueID  int64  `db:"issue_id"`
+	// Zero for issue creations.
+	UpdateID int64 `db:"update_id"`
+}
+
+// IssueChange is a change to an issue: either its creation, or an update.
+type IssueChange struct {
+	IssueChangePosition
+	// Set if the change is an update.
+	Update *IssueUpdate
 }
 
 type IssueGetter interface {
 	Get(id int64) (*Issue, error)
-	Filter(filter IssueFilter, order IssueOrderBy, opts *IssueFilterOpts) ([]*Issue, error)
+	// Filter returns issues passing a filter, ordered by the given keys, and
+	// then by ID.
+	Filter(filter IssueFilter, order []IssueOrderBy, opts *IssueFilterOpts) ([]*Issue, error)
+	// Count returns the amount of issues passing a filter.
+	Count(filter IssueFilter) (int64, error)
+	// CountBy returns the amount of issues passing a filter for every value
+	// of a field, most common values first. At most limit values are
+	// returned, unless limit is zero.
+	CountBy(filter IssueFilter, facet IssueFacet, limit int64) ([]*IssueFacetCount, error)
 	GetHistory(id int64, opts *IssueGetHistoryOpts) ([]*IssueUpdate, error)
+	// GetChanges returns up to count changes to all issues, in commit order,
+	// starting after a given position (or from the beginning if nil).
+	GetChanges(after *IssueChangePosition, count int64) ([]*IssueChange, error)
 	New(new *Issue) (*Issue, error)
 	Update(update *IssueUpdate) error
 }
@@ -201,7 +456,8 @@ func (d *databaseIssue) Get(id int64) (*Issue, error) {
 			issues.assignee_id AS assignee_id,
 			issues."type" AS "type",
 			issues.priority AS priority,
-			issues.status AS status
+			issues.status AS status,
+			issues.category_id AS category_id
 		FROM
 			issues
 		WHERE
@@ -216,10 +472,101 @@ func (d *databaseIssue) Get(id int64) (*Issue, error) {
 	if len(data) != 1 {
 		return nil, IssueErrorNotFound
 	}
+	if err := d.getCC(data...); err != nil {
+		return nil, err
+	}
 
 	return data[0], nil
 }
 
+// getCC fills in the CC lists of the given issues.
+func (d *databaseIssue) getCC(issues ...*Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*Issue)
+	var ids []string
+	for _, i := range issues {
+		byID[i.ID] = i
+		ids = append(ids, strconv.FormatInt(i.ID, 10))
+	}
+
+	parameters, in := inList(nil, ids...)
+	q := fmt.Sprintf(`
+		SELECT
+			issue_cc_lists.issue_id AS issue_id,
+			issue_cc_lists.member_id AS member_id
+		FROM
+			issue_cc_lists
+		WHERE
+			issue_cc_lists.issue_id IN %s
+		ORDER BY
+			issue_cc_lists.issue_id, issue_cc_lists.member_id
+	`, in)
+
+	var data []struct {
+		IssueID  int64  `db:"issue_id"`
+		MemberID string `db:"member_id"`
+	}
+	conv := NewErrorConverter()
+	if err := d.tx.SelectContext(d.ctx, &data, q, parameters...); err != nil {
+		return conv.Convert(err)
+	}
+	for _, cc := range data {
+		i := byID[cc.IssueID]
+		i.CCIDs = append(i.CCIDs, cc.MemberID)
+	}
+	return nil
+}
+
+// getUpdateCC fills in the CC list changes of the given updates, which must
+// all belong to the given issue.
+func (d *databaseIssue) getUpdateCC(issueID int64, updates ...*IssueUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	byID := make(map[int64]*IssueUpdate)
+	var ids []string
+	for _, u := range updates {
+		byID[u.UpdateID] = u
+		ids = append(ids, strconv.FormatInt(u.UpdateID, 10))
+	}
+
+	parameters, in := inList([]interface{}{issueID}, ids...)
+	q := fmt.Sprintf(`
+		SELECT
+			issue_update_cc_lists.update_id AS update_id,
+			issue_update_cc_lists.member_id AS member_id,
+			issue_update_cc_lists.removed AS removed
+		FROM
+			issue_update_cc_lists
+		WHERE
+			issue_update_cc_lists.issue_id = $1
+			AND issue_update_cc_lists.update_id IN %s
+		ORDER BY
+			issue_update_cc_lists.update_id, issue_update_cc_lists.member_id
+	`, in)
+
+	var data []struct {
+		UpdateID int64  `db:"update_id"`
+		MemberID string `db:"member_id"`
+		Removed  bool   `db:"removed"`
+	}
+	conv := NewErrorConverter()
+	if err := d.tx.SelectContext(d.ctx, &data, q, parameters...); err != nil {
+		return conv.Convert(err)
+	}
+	for _, cc := range data {
+		u := byID[cc.UpdateID]
+		if cc.Removed {
+			u.CCRemovedIDs = append(u.CCRemovedIDs, cc.MemberID)
+		} else {
+			u.CCAddedIDs = append(u.CCAddedIDs, cc.MemberID)
+		}
+	}
+	return nil
+}
+
 func (d *databaseIssue) GetHistory(id int64, opts *IssueGetHistoryOpts) ([]*IssueUpdate, error) {
 
 	q := `
@@ -232,21 +579,29 @@ func (d *databaseIssue) GetHistory(id int64, opts *IssueGetHistoryOpts) ([]*Issu
 			issue_updates.assignee_id AS assignee_id,
 			issue_updates.type AS type,
 			issue_updates.priority AS priority,
-			issue_updates.status AS status
+			issue_updates.status AS status,
+			issue_updates.category_id AS category_id
 		FROM
 			issue_updates
 		WHERE
 			issue_updates.issue_id = $1
 	`
 
-	if opts != nil {
-		if opts.Start > 0 {
-			q += fmt.Sprintf("AND issue_updates.id > %d", opts.Start)
-		}
-		if opts.Count > 0 {
-			q += fmt.Sprintf("LIMIT %d", opts.Count)
+	reverse := opts != nil && opts.Reverse
+	if opts != nil && opts.Start > 0 {
+		if reverse {
+			q += fmt.Sprintf(" AND issue_updates.id < %d", opts.Start)
+		} else {
+			q += fmt.Sprintf(" AND issue_updates.id > %d", opts.Start)
 		}
 	}
+	q += " ORDER BY issue_updates.id"
+	if reverse {
+		q += " DESC"
+	}
+	if opts != nil && opts.Count > 0 {
+		q += fmt.Sprintf(" LIMIT %d", opts.Count)
+	}
 
 	var data []*IssueUpdate
 	conv := NewErrorConverter()
@@ -254,11 +609,199 @@ func (d *databaseIssue) GetHistory(id int64, opts *IssueGetHistoryOpts) ([]*Issu
 	if err != nil {
 		return nil, conv.Convert(err)
 	}
+	if err := d.getUpdateCC(id, data...); err != nil {
+		return nil, err
+	}
 
 	return data, nil
 }
 
-func (d *databaseIssue) Filter(filter IssueFilter, order IssueOrderBy, opts *IssueFilterOpts) ([]*Issue, error) {
+func (d *databaseIssue) GetChanges(after *IssueChangePosition, count int64) ([]*IssueChange, error) {
+	if after == nil {
+		after = &IssueChangePosition{CommitTS: "0", IssueID: 0, UpdateID: -1}
+	}
+	// A transaction that writes a commit timestamp cannot be pushed past
+	// reads at a later timestamp. Thus, once a change is visible here, no
+	// change with a lower position can become visible later on.
+	q := `
+		SELECT commit_ts, issue_id, update_id FROM (
+			SELECT
+				issues.commit_ts AS commit_ts,
+				issues.id AS issue_id,
+				0 AS update_id
+			FROM
+				issues
+			WHERE
+				(issues.commit_ts, issues.id, 0) > ($1::DECIMAL, $2::INT8, $3::INT8)
+			UNION ALL
+			SELECT
+				issue_updates.commit_ts AS commit_ts,
+				issue_updates.issue_id AS issue_id,
+				issue_updates.id AS update_id
+			FROM
+				issue_updates
+			WHERE
+				(issue_updates.commit_ts, issue_updates.issue_id, issue_updates.id) > ($1::DECIMAL, $2::INT8, $3::INT8)
+		)
+		ORDER BY commit_ts, issue_id, update_id
+		LIMIT $4
+	`
+	var positions []IssueChangePosition
+	conv := NewErrorConverter()
+	err := d.tx.SelectContext(d.ctx, &positions, q, after.CommitTS, after.IssueID, after.UpdateID, count)
+	if err != nil {
+		return nil, conv.Convert(err)
+	}
+
+	// Retrieve the updates referred to by the feed, per issue.
+	res := make([]*IssueChange, len(positions))
+	updates := make(map[int64][]string)
+	for i, p := range positions {
+		res[i] = &IssueChange{IssueChangePosition: p}
+		if p.UpdateID != 0 {
+			updates[p.IssueID] = append(updates[p.IssueID], strconv.FormatInt(p.UpdateID, 10))
+		}
+	}
+	byPosition := make(map[[2]int64]*IssueUpdate)
+	for issueID, ids := range updates {
+		parameters, in := inList([]interface{}{issueID}, ids...)
+		q := fmt.Sprintf(`
+			SELECT
+				issue_updates.issue_id AS issue_id,
+				issue_updates.id AS id,
+				issue_updates.created AS created,
+				issue_updates.author_id AS author_id,
+				issue_updates.comment AS comment,
+				issue_updates.title AS title,
+				issue_updates.assignee_id AS assignee_id,
+				issue_updates.type AS type,
+				issue_updates.priority AS priority,
+				issue_updates.status AS status,
+				issue_updates.category_id AS category_id
+			FROM
+				issue_updates
+			WHERE
+				issue_updates.issue_id = $1
+				AND issue_updates.id IN %s
+		`, in)
+		var data []*IssueUpdate
+		if err := d.tx.SelectContext(d.ctx, &data, q, parameters...); err != nil {
+			return nil, conv.Convert(err)
+		}
+		if err := d.getUpdateCC(issueID, data...); err != nil {
+			return nil, err
+		}
+		for _, u := range data {
+			byPosition[[2]int64{u.IssueID, u.UpdateID}] = u
+		}
+	}
+	for _, c := range res {
+		if c.UpdateID != 0 {
+			c.Update = byPosition[[2]int64{c.IssueID, c.UpdateID}]
+		}
+	}
+
+	return res, nil
+}
+
+// where builds an SQL boolean expression that is true for issues passing the
+// filter. Any query parameters are appended to the given parameters.
+func (f *IssueFilter) where(parameters []interface{}) ([]interface{}, string) {
+	var conditions []string
+	var in string
+	if len(f.Authors) > 0 {
+		parameters, in = inList(parameters, f.Authors...)
+		conditions = append(conditions, fmt.Sprintf("issues.author_id IN %s", in))
+	}
+	if len(f.Assignees) > 0 {
+		parameters, in = inList(parameters, f.Assignees...)
+		conditions = append(conditions, fmt.Sprintf("issues.assignee_id IN %s", in))
+	}
+	if len(f.CCs) > 0 {
+		parameters, in = inList(parameters, f.CCs...)
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM issue_cc_lists
+			WHERE issue_cc_lists.issue_id = issues.id AND issue_cc_lists.member_id IN %s
+		)`, in))
+	}
+	if len(f.Commenters) > 0 {
+		parameters, in = inList(parameters, f.Commenters...)
+		conditions = append(conditions, fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM issue_updates
+			WHERE issue_updates.issue_id = issues.id AND issue_updates.author_id IN %s
+				AND issue_updates.comment IS NOT NULL AND issue_updates.comment != ''
+		)`, in))
+	}
+	if len(f.Statuses) > 0 {
+		parameters, in = inListInt64(parameters, f.Statuses...)
+		conditions = append(conditions, fmt.Sprintf("issues.status IN %s", in))
+	}
+	if len(f.Types) > 0 {
+		parameters, in = inListInt64(parameters, f.Types...)
+		conditions = append(conditions, fmt.Sprintf(`issues."type" IN %s`, in))
+	}
+	if f.Title != "" {
+		escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+		parameters = append(parameters, "%"+escaper.Replace(f.Title)+"%")
+		conditions = append(conditions, fmt.Sprintf("issues.title ILIKE $%d", len(parameters)))
+	}
+	if f.Assigned {
+		parameters = append(parameters, UnassignedUUID)
+		conditions = append(conditions, fmt.Sprintf("issues.assignee_id != $%d", len(parameters)))
+	}
+	if len(f.Categories) > 0 {
+		parameters, in = inList(parameters, f.Categories...)
+		conditions = append(conditions, fmt.Sprintf("issues.category_id IN %s", in))
+	}
+	if len(f.IDs) > 0 {
+		parameters, in = inListInt64(parameters, f.IDs...)
+		conditions = append(conditions, fmt.Sprintf("issues.id IN %s", in))
+	}
+	for _, r := range []struct {
+		column string
+		r      IssueRange
+	}{
+		{"issues.priority", f.Priority},
+		{"issues.created", f.Created},
+		{"issues.last_updated", f.Updated},
+	} {
+		if r.r.Min.Valid {
+			parameters = append(parameters, r.r.Min.Int64)
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", r.column, len(parameters)))
+		}
+		if r.r.Max.Valid {
+			parameters = append(parameters, r.r.Max.Int64)
+			conditions = append(conditions, fmt.Sprintf("%s < $%d", r.column, len(parameters)))
+		}
+	}
+
+	var condition string
+	for _, sub := range f.And {
+		parameters, condition = sub.where(parameters)
+		conditions = append(conditions, condition)
+	}
+	if len(f.Or) > 0 {
+		var or []string
+		for _, sub := range f.Or {
+			parameters, condition = sub.where(parameters)
+			or = append(or, condition)
+		}
+		conditions = append(conditions, "("+strings.Join(or, " OR ")+")")
+	}
+	if f.Not != nil {
+		// IS NOT TRUE instead of NOT, so that NULLs (eg. from comparisons
+		// against a NULL column) are treated as false before negation.
+		parameters, condition = f.Not.where(parameters)
+		conditions = append(conditions, condition+" IS NOT TRUE")
+	}
+
+	if len(conditions) == 0 {
+		return parameters, "TRUE"
+	}
+	return parameters, "(" + strings.Join(conditions, " AND ") + ")"
+}
+
+func (d *databaseIssue) Filter(filter IssueFilter, order []IssueOrderBy, opts *IssueFilterOpts) ([]*Issue, error) {
 	q := `
 		SELECT
 			issues.id AS id,
@@ -270,60 +813,82 @@ func (d *databaseIssue) Filter(filter IssueFilter, order IssueOrderBy, opts *Iss
 			issues.assignee_id AS assignee_id,
 			issues."type" AS "type",
 			issues.priority AS priority,
-			issues.status AS status
+			issues.status AS status,
+			issues.category_id AS category_id,
+
+			assignees.username AS assignee_username
 		FROM
 			issues
+		INNER JOIN
+			users AS assignees ON assignees.id = issues.assignee_id
 	`
 
-	var conditions []string
-	var parameters []interface{}
-	if filter.Author != "" {
-		parameters = append(parameters, filter.Author)
-		conditions = append(conditions, fmt.Sprintf("issues.author_id = $%d", len(parameters)))
-	}
-	if filter.Assignee != "" {
-		parameters = append(parameters, filter.Assignee)
-		conditions = append(conditions, fmt.Sprintf("issues.assignee_id = $%d", len(parameters)))
-	}
-	if filter.Status != 0 {
-		parameters = append(parameters, filter.Status)
-		conditions = append(conditions, fmt.Sprintf("issues.status = $%d", len(parameters)))
-	}
+	parameters, condition := filter.where(nil)
+	conditions := []string{condition}
 
-	orderField := "issues.created"
-	if opts != nil && opts.Start > 0 {
-		switch order.By {
-		case IssueOrderCreated:
-			orderField = "issues.created"
-		case IssueOrderUpdated:
-			orderField = "issues.last_updated"
-		default:
+	// Issues are always ordered by ID last, so that the ordering is total.
+	order = append(order[:len(order):len(order)], IssueOrderBy{Ascending: true, By: issueOrderID})
+	if opts != nil && opts.Reverse {
+		reversed := make([]IssueOrderBy, len(order))
+		for i, o := range order {
+			reversed[i] = IssueOrderBy{Ascending: !o.Ascending, By: o.By}
+		}
+		order = reversed
+	}
+	columns := make([]string, len(order))
+	orderings := make([]string, len(order))
+	for i, o := range order {
+		columns[i] = o.By.column()
+		if columns[i] == "" {
 			return nil, status.Errorf(codes.InvalidArgument, "invalid order")
 		}
-		parameters = append(parameters, opts.Start)
-		if order.Ascending {
-			conditions = append(conditions, fmt.Sprintf("%s > $%d", orderField, len(parameters)))
-		} else {
-			conditions = append(conditions, fmt.Sprintf("%s < $%d", orderField, len(parameters)))
+		orderings[i] = columns[i] + " DESC"
+		if o.Ascending {
+			orderings[i] = columns[i] + " ASC"
 		}
 	}
 
-	if len(conditions) > 0 {
-		q += fmt.Sprintf(`
-			WHERE
-				%s
-		`, strings.Join(conditions, " AND "))
+	if opts != nil && opts.After != nil {
+		after := opts.After
+		if len(after.Key) != len(order)-1 {
+			return nil, status.Error(codes.InvalidArgument, "position does not match order")
+		}
+		key := append(after.Key[:len(after.Key):len(after.Key)], after.ID)
+		// Keyset pagination on a compound key with mixed directions: an issue
+		// is after the given one if it's after it on the first key, or equal
+		// on the first key and after it on the second key, and so on.
+		var alternatives []string
+		var equal []string
+		for i, o := range order {
+			// Values must be of the same type as the ordered field.
+			var ok bool
+			switch o.By.value(&Issue{}).(type) {
+			case int64:
+				_, ok = key[i].(int64)
+			case string:
+				_, ok = key[i].(string)
+			}
+			if !ok {
+				return nil, status.Error(codes.InvalidArgument, "position does not match order")
+			}
+			parameters = append(parameters, key[i])
+			op := "<"
+			if o.Ascending {
+				op = ">"
+			}
+			cond := append(equal[:len(equal):len(equal)], fmt.Sprintf("%s %s $%d", columns[i], op, len(parameters)))
+			alternatives = append(alternatives, "("+strings.Join(cond, " AND ")+")")
+			equal = append(equal, fmt.Sprintf("%s = $%d", columns[i], len(parameters)))
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
 	}
 
-	if order.Ascending {
-		q += fmt.Sprintf(`
-			ORDER BY %s ASC
-		`, orderField)
-	} else {
-		q += fmt.Sprintf(`
-			ORDER BY %s DESC
-		`, orderField)
-	}
+	q += fmt.Sprintf(`
+		WHERE
+			%s
+		ORDER BY
+			%s
+	`, strings.Join(conditions, " AND "), strings.Join(orderings, ", "))
 
 	if opts != nil && opts.Count > 0 {
 		parameters = append(parameters, opts.Count)
@@ -339,10 +904,71 @@ func (d *databaseIssue) Filter(filter IssueFilter, order IssueOrderBy, opts *Iss
 	if err != nil {
 		return nil, conv.Convert(err)
 	}
+	if err := d.getCC(data...); err != nil {
+		return nil, err
+	}
 
 	return data, nil
 }
 
+func (d *databaseIssue) Count(filter IssueFilter) (int64, error) {
+	parameters, condition := filter.where(nil)
+	q := fmt.Sprintf(`
+		SELECT
+			count(*)
+		FROM
+			issues
+		WHERE
+			%s
+	`, condition)
+
+	var count int64
+	conv := NewErrorConverter().
+		WithSyntaxError(UserErrorNoSuchUsername)
+	err := d.tx.GetContext(d.ctx, &count, q, parameters...)
+	if err != nil {
+		return 0, conv.Convert(err)
+	}
+	return count, nil
+}
+
+func (d *databaseIssue) CountBy(filter IssueFilter, facet IssueFacet, limit int64) ([]*IssueFacetCount, error) {
+	column := facet.column()
+	if column == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid facet")
+	}
+	parameters, condition := filter.where(nil)
+	// Ties are broken by value, so that results are stable.
+	q := fmt.Sprintf(`
+		SELECT
+			%s::STRING AS value,
+			count(*) AS count
+		FROM
+			issues
+		WHERE
+			%s
+		GROUP BY
+			value
+		ORDER BY
+			count DESC, value ASC
+	`, column, condition)
+	if limit > 0 {
+		parameters = append(parameters, limit)
+		q += fmt.Sprintf(`
+			LIMIT $%d
+		`, len(parameters))
+	}
+
+	var data []*IssueFacetCount
+	conv := NewErrorConverter().
+		WithSyntaxError(UserErrorNoSuchUsername)
+	err := d.tx.SelectContext(d.ctx, &data, q, parameters...)
+	if err != nil {
+		return nil, conv.Convert(err)
+	}
+	return data, nil
+}
+
 func (d *databaseIssue) New(new *Issue) (*Issue, error) {
 	if new.ID != 0 {
 		return nil, status.Error(codes.InvalidArgument, "issue cannot contain preset id")
@@ -359,16 +985,26 @@ func (d *databaseIssue) New(new *Issue) (*Issue, error) {
 	q := `
 		INSERT INTO issues
 			(author_id, created, last_updated,
-			 title, assignee_id, "type", priority, status)
+			 title, assignee_id, "type", priority, status,
+			 category_id, commit_ts)
 		VALUES
 			(:author_id, :created, :last_updated,
-			 :title, :assignee_id, :type, :priority, :status)
+			 :title, :assignee_id, :type, :priority, :status,
+			 :category_id, cluster_logical_timestamp())
 		RETURNING id
 	`
 	data := *new
 	if data.AssigneeID == "" {
 		data.AssigneeID = UnassignedUUID
 	}
+	if data.CategoryID == "" {
+		data.CategoryID = RootCategory
+	}
+	// Ensure that the category exists. See the similar check in
+	// databaseCategory.New for why this isn't left to constraints.
+	if _, err := d.category.Get(data.CategoryID); err != nil {
+		return nil, err
+	}
 
 	rows, err := d.tx.NamedQuery(q, &data)
 	if err != nil {
@@ -389,6 +1025,19 @@ func (d *databaseIssue) New(new *Issue) (*Issue, error) {
 	log15.Info("created new issue", "id", id)
 	data.ID = id
 
+	for _, member := range data.CCIDs {
+		q := `
+			INSERT INTO issue_cc_lists
+				(issue_id, member_id)
+			VALUES
+				($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := d.tx.ExecContext(d.ctx, q, id, member); err != nil {
+			return nil, conv.Convert(err)
+		}
+	}
+
 	return &data, nil
 }
 
@@ -425,6 +1074,13 @@ func (d *databaseIssue) Update(update *IssueUpdate) error {
 		updates = append(updates, "status")
 		args = append(args, data.Status.Int64)
 	}
+	if data.CategoryID.Valid {
+		if _, err := d.category.Get(data.CategoryID.String); err != nil {
+			return err
+		}
+		updates = append(updates, "category_id")
+		args = append(args, data.CategoryID.String)
+	}
 
 	var updateStrings []string
 	for i, u := range updates {
@@ -449,19 +1105,72 @@ func (d *databaseIssue) Update(update *IssueUpdate) error {
 		INSERT INTO issue_updates
 			(issue_id, created, author_id, comment,
 			 title, assignee_id, type, priority, status,
-			 id)
+			 category_id, commit_ts, id)
 		VALUES
 			(:issue_id, :created, :author_id, :comment,
 			 :title, :assignee_id, :type, :priority, :status,
-			 (
+			 :category_id, cluster_logical_timestamp(), (
 			   SELECT COUNT(*)+1 from issue_updates where issue_id = :issue_id
 			 )
 			)
+		RETURNING id
 	`
-	_, err = d.tx.NamedExec(q, &data)
+	rows, err := d.tx.NamedQuery(q, &data)
 	if err != nil {
 		return conv.Convert(err)
 	}
+	if !rows.Next() {
+		rows.Close()
+		return status.Error(codes.Unavailable, "could not create issue update")
+	}
+	if err = rows.Scan(&data.UpdateID); err != nil {
+		rows.Close()
+		return conv.Convert(err)
+	}
+	rows.Close()
+
+	// Apply CC list changes to the issue and record them in the update.
+	for _, member := range data.CCAddedIDs {
+		q := `
+			INSERT INTO issue_cc_lists
+				(issue_id, member_id)
+			VALUES
+				($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := d.tx.ExecContext(d.ctx, q, data.IssueID, member); err != nil {
+			return conv.Convert(err)
+		}
+	}
+	for _, member := range data.CCRemovedIDs {
+		q := `
+			DELETE FROM issue_cc_lists
+			WHERE
+				issue_id = $1 AND member_id = $2
+		`
+		if _, err := d.tx.ExecContext(d.ctx, q, data.IssueID, member); err != nil {
+			return conv.Convert(err)
+		}
+	}
+	for _, change := range []struct {
+		members []string
+		removed bool
+	}{
+		{data.CCAddedIDs, false},
+		{data.CCRemovedIDs, true},
+	} {
+		for _, member := range change.members {
+			q := `
+				INSERT INTO issue_update_cc_lists
+					(issue_id, update_id, member_id, removed)
+				VALUES
+					($1, $2, $3, $4)
+			`
+			if _, err := d.tx.ExecContext(d.ctx, q, data.IssueID, data.UpdateID, member, change.removed); err != nil {
+				return conv.Convert(err)
+			}
+		}
+	}
 
 	return nil
 }
@@ -211,3 +211,89 @@ func TestIssueHistory(t *testing.T) {
 		}
 	}
 }
+
+func TestIssueCategories(t *testing.T) {
+	ctx := context.Background()
+	db, stop := dut(ctx, t)
+	defer stop()
+
+	s := db.Do(ctx)
+
+	cat, err := s.Category().New(&Category{
+		Name:       "hardware",
+		ParentUUID: RootCategory,
+	})
+	if err != nil {
+		t.Fatalf("Category.New: %v", err)
+	}
+
+	// Issues without a category get filed in the root category.
+	issue, err := s.Issue().New(&Issue{
+		AuthorID: testUsers["q3k"],
+		Title:    "test issue",
+		Type:     1,
+		Priority: 3,
+		Status:   1,
+	})
+	if err != nil {
+		t.Fatalf("Issue.New(no category): %v", err)
+	}
+	if want, got := RootCategory, issue.CategoryID; want != got {
+		t.Errorf("issue.CategoryID is %q, want %q", got, want)
+	}
+
+	// Issues cannot be filed in nonexistent categories.
+	_, err = s.Issue().New(&Issue{
+		AuthorID:   testUsers["q3k"],
+		Title:      "test issue",
+		Type:       1,
+		Priority:   3,
+		Status:     1,
+		CategoryID: "ddacd7d8-6d4e-4013-be58-cac97fe12cc6",
+	})
+	if want, got := CategoryErrorNotFound, err; want != got {
+		t.Fatalf("Issue.New(nonexistent category): wanted %v, got %v", want, got)
+	}
+
+	// Move issue to category, ensure it's recorded in history.
+	err = s.Issue().Update(&IssueUpdate{
+		IssueID:    issue.ID,
+		AuthorID:   testUsers["q3k"],
+		CategoryID: sql.NullString{String: cat.UUID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Issue.Update(category): %v", err)
+	}
+	issue, err = s.Issue().Get(issue.ID)
+	if err != nil {
+		t.Fatalf("Issue.Get: %v", err)
+	}
+	if want, got := cat.UUID, issue.CategoryID; want != got {
+		t.Errorf("issue.CategoryID is %q, want %q", got, want)
+	}
+	updates, err := s.Issue().GetHistory(issue.ID, nil)
+	if err != nil {
+		t.Fatalf("Issue.GetHistory: %v", err)
+	}
+	if want, got := 1, len(updates); want != got {
+		t.Fatalf("wanted %d updates, got %d", want, got)
+	}
+	if want, got := cat.UUID, updates[0].CategoryID.String; want != got {
+		t.Errorf("update category is %q, want %q", got, want)
+	}
+
+	// Filter by category.
+	issues, err := s.Issue().Filter(IssueFilter{Categories: []string{cat.UUID}}, nil, nil)
+	if err != nil {
+		t.Fatalf("Issue.Filter: %v", err)
+	}
+	if want, got := 1, len(issues); want != got {
+		t.Fatalf("wanted %d issues, got %d", want, got)
+	}
+
+	// Categories with issues cannot be removed.
+	err = s.Category().Delete(cat.UUID)
+	if want, got := CategoryErrorNotEmpty, err; want != got {
+		t.Fatalf("Category.Delete(with issues): wanted %v, got %v", want, got)
+	}
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	cpb "github.com/q3k/bugless/proto/common"
 
@@ -39,13 +41,41 @@ func (u *User) Proto() *cpb.User {
 	}
 }
 
+func (u *User) ProfileProto() *cpb.UserProfile {
+	return &cpb.UserProfile{
+		User:        u.Proto(),
+		Email:       u.Email.String,
+		DisplayName: u.DisplayName.String,
+	}
+}
+
 type UserGetter interface {
 	New(new *User) (*User, error)
 	// ResolveUsername resolves a username to its UUID.
 	ResolveUsername(username string) (uuid string, err error)
 	Get(uuid string) (*User, error)
+	// GetMany retrieves users by UUID. Users that do not exist are not
+	// returned.
+	GetMany(uuids []string) ([]*User, error)
+	// GetManyByUsername retrieves users by username. Users that do not exist
+	// are not returned.
+	GetManyByUsername(usernames []string) ([]*User, error)
+	// GetByUsernamePrefix retrieves up to count users whose username starts
+	// with a given prefix, ordered by username.
+	GetByUsernamePrefix(prefix string, count int64) ([]*User, error)
+	// Update saves the given user's email and display name.
+	Update(u *User) error
 }
 
+// userColumns are the columns selected when retrieving a User.
+const userColumns = `
+	users.id AS id,
+	users.username AS username,
+	users.preferences AS preferences,
+	users.email AS email,
+	users.display_name as display_name
+`
+
 type databaseUser struct {
 	*session
 }
@@ -59,9 +89,9 @@ func (d *databaseUser) New(new *User) (*User, error) {
 
 	q := `
 		INSERT INTO users
-			(username, preferences)
+			(username, preferences, email, display_name)
 		VALUES
-			(:username, '')
+			(:username, '', :email, :display_name)
 		RETURNING id
 	`
 	data := *new
@@ -73,7 +103,7 @@ func (d *databaseUser) New(new *User) (*User, error) {
 	// Get new ID
 	if !rows.Next() {
 		rows.Close()
-		return nil, status.Error(codes.Unavailable, "could not create category")
+		return nil, status.Error(codes.Unavailable, "could not create user")
 	}
 
 	var uuid string
@@ -138,3 +168,101 @@ func (d *databaseUser) Get(uuid string) (*User, error) {
 
 	return data[0], nil
 }
+
+func (d *databaseUser) GetMany(uuids []string) ([]*User, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	conv := NewErrorConverter().
+		WithSyntaxError(UserErrorNoSuchUser)
+
+	parameters, in := inList(nil, uuids...)
+	q := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			users
+		WHERE
+			id IN %s
+	`, userColumns, in)
+
+	var data []*User
+	err := d.tx.SelectContext(d.ctx, &data, q, parameters...)
+	if err != nil {
+		return nil, conv.Convert(err)
+	}
+	return data, nil
+}
+
+func (d *databaseUser) GetManyByUsername(usernames []string) ([]*User, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	conv := NewErrorConverter()
+
+	parameters, in := inList(nil, usernames...)
+	q := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			users
+		WHERE
+			username IN %s
+	`, userColumns, in)
+
+	var data []*User
+	err := d.tx.SelectContext(d.ctx, &data, q, parameters...)
+	if err != nil {
+		return nil, conv.Convert(err)
+	}
+	return data, nil
+}
+
+func (d *databaseUser) GetByUsernamePrefix(prefix string, count int64) ([]*User, error) {
+	conv := NewErrorConverter()
+
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	q := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			users
+		WHERE
+			username LIKE $1 AND id != $2
+		ORDER BY
+			username ASC
+		LIMIT $3
+	`, userColumns)
+
+	var data []*User
+	err := d.tx.SelectContext(d.ctx, &data, q, escaper.Replace(prefix)+"%", UnassignedUUID, count)
+	if err != nil {
+		return nil, conv.Convert(err)
+	}
+	return data, nil
+}
+
+func (d *databaseUser) Update(u *User) error {
+	if u.ID == "" {
+		return status.Error(codes.InvalidArgument, "an updated user must already be saved")
+	}
+	conv := NewErrorConverter().
+		WithSyntaxError(UserErrorNoSuchUser)
+
+	q := `
+		UPDATE users
+		SET
+			email = :email,
+			display_name = :display_name
+		WHERE
+			id = :id
+	`
+	res, err := d.tx.NamedExecContext(d.ctx, q, u)
+	if err != nil {
+		return conv.Convert(err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return UserErrorNoSuchUser
+	}
+	return nil
+}
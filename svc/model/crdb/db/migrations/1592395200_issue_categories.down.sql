@@ -0,0 +1,13 @@
+-- Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+
+ALTER TABLE issue_updates
+    DROP CONSTRAINT fk_category;
+ALTER TABLE issue_updates
+    DROP COLUMN category_id;
+
+DROP INDEX issues@issues_category_id;
+ALTER TABLE issues
+    DROP CONSTRAINT fk_category;
+ALTER TABLE issues
+    DROP COLUMN category_id;
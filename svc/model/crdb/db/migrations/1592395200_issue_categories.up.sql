@@ -0,0 +1,17 @@
+-- Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+
+-- Every issue belongs to a category. Existing issues are moved to the root
+-- category.
+ALTER TABLE issues
+    ADD COLUMN category_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000';
+ALTER TABLE issues
+    ADD CONSTRAINT fk_category FOREIGN KEY (category_id) REFERENCES categories (id);
+CREATE INDEX issues_category_id ON issues (category_id);
+
+-- Like other updatable fields, a NULL category in an update means that the
+-- category was not changed.
+ALTER TABLE issue_updates
+    ADD COLUMN category_id UUID;
+ALTER TABLE issue_updates
+    ADD CONSTRAINT fk_category FOREIGN KEY (category_id) REFERENCES categories (id);
@@ -0,0 +1,5 @@
+-- Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+
+ALTER TABLE issue_update_cc_lists
+    DROP COLUMN removed;
@@ -0,0 +1,7 @@
+-- Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+
+-- CC list updates record both additions to and removals from the CC list.
+-- Existing rows (if any) can only have been additions.
+ALTER TABLE issue_update_cc_lists
+    ADD COLUMN removed BOOL NOT NULL DEFAULT false;
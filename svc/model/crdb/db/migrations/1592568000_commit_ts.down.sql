@@ -0,0 +1,10 @@
+-- Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+
+DROP INDEX issue_updates@issue_updates_commit_ts;
+ALTER TABLE issue_updates
+    DROP COLUMN commit_ts;
+
+DROP INDEX issues@issues_commit_ts;
+ALTER TABLE issues
+    DROP COLUMN commit_ts;
@@ -0,0 +1,15 @@
+-- Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+
+-- Commit timestamps (as returned by cluster_logical_timestamp()) of issue
+-- creations and issue updates. These order all changes to issues in commit
+-- order, and back the global change feed.
+-- Existing rows get a zero timestamp, and are thus ordered before all new
+-- changes.
+ALTER TABLE issues
+    ADD COLUMN commit_ts DECIMAL NOT NULL DEFAULT 0;
+CREATE INDEX issues_commit_ts ON issues (commit_ts, id);
+
+ALTER TABLE issue_updates
+    ADD COLUMN commit_ts DECIMAL NOT NULL DEFAULT 0;
+CREATE INDEX issue_updates_commit_ts ON issue_updates (commit_ts, issue_id, id);
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxCategoryLevels is the maximum depth of a category tree that can be
+// requested at once.
+const maxCategoryLevels = 16
+
+func (s *Service) GetCategoryTree(ctx context.Context, req *spb.ModelGetCategoryTreeRequest) (*spb.ModelGetCategoryTreeResponse, error) {
+	id := req.Id
+	if id == "" {
+		id = db.RootCategory
+	}
+	if req.Levels > maxCategoryLevels {
+		return nil, status.Errorf(codes.InvalidArgument, "levels must be at most %d", maxCategoryLevels)
+	}
+
+	tree, err := s.db.Do(ctx).Category().GetTree(id, uint(req.Levels))
+	if err != nil {
+		return nil, err
+	}
+	return &spb.ModelGetCategoryTreeResponse{
+		Root: tree.Proto(),
+	}, nil
+}
+
+func (s *Service) NewCategory(ctx context.Context, req *spb.ModelNewCategoryRequest) (*spb.ModelNewCategoryResponse, error) {
+	if req.ParentId == "" {
+		return nil, status.Error(codes.InvalidArgument, "parent_id must be set")
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name must be set")
+	}
+
+	cat, err := s.db.Do(ctx).Category().New(&db.Category{
+		ParentUUID:  req.ParentId,
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &spb.ModelNewCategoryResponse{
+		Id: cat.UUID,
+	}, nil
+}
+
+func (s *Service) UpdateCategory(ctx context.Context, req *spb.ModelUpdateCategoryRequest) (*spb.ModelUpdateCategoryResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id must be set")
+	}
+	if req.Id == db.RootCategory {
+		return nil, status.Error(codes.InvalidArgument, "cannot update root category")
+	}
+
+	session := s.db.Begin(ctx)
+	defer session.Rollback()
+
+	cat, err := session.Category().Get(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		cat.Name = req.Name
+	}
+	if req.ParentId != "" {
+		cat.ParentUUID = req.ParentId
+	}
+	if req.Description != nil {
+		cat.Description = req.Description.Value
+	}
+
+	if err := session.Category().Update(cat); err != nil {
+		return nil, err
+	}
+	return &spb.ModelUpdateCategoryResponse{}, session.Commit()
+}
+
+func (s *Service) DeleteCategory(ctx context.Context, req *spb.ModelDeleteCategoryRequest) (*spb.ModelDeleteCategoryResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id must be set")
+	}
+
+	session := s.db.Begin(ctx)
+	defer session.Rollback()
+
+	// Delete swallows nonexistent categories, so check for existence first
+	// to be able to return NotFound.
+	if _, err := session.Category().Get(req.Id); err != nil {
+		return nil, err
+	}
+	if err := session.Category().Delete(req.Id); err != nil {
+		return nil, err
+	}
+	return &spb.ModelDeleteCategoryResponse{}, session.Commit()
+}
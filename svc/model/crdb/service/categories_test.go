@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCategories(t *testing.T) {
+	ctx := context.Background()
+
+	model, _, cancel := dutModel()
+	defer cancel()
+
+	mkCategory := func(parent, name string) string {
+		res, err := model.NewCategory(ctx, &spb.ModelNewCategoryRequest{
+			ParentId: parent,
+			Name:     name,
+		})
+		if err != nil {
+			t.Fatalf("NewCategory(%q): %v", name, err)
+		}
+		return res.Id
+	}
+
+	// root -.-> hardware -.-> network
+	//       |             '-> storage
+	//       '-> software
+	hardware := mkCategory(db.RootCategory, "hardware")
+	network := mkCategory(hardware, "network")
+	mkCategory(hardware, "storage")
+	software := mkCategory(db.RootCategory, "software")
+
+	// Duplicate names are rejected.
+	_, err := model.NewCategory(ctx, &spb.ModelNewCategoryRequest{
+		ParentId: db.RootCategory,
+		Name:     "hardware",
+	})
+	if want, got := codes.AlreadyExists, status.Code(err); want != got {
+		t.Fatalf("NewCategory(duplicate): wanted %v, got %v", want, got)
+	}
+
+	// Retrieve the entire tree.
+	tree, err := model.GetCategoryTree(ctx, &spb.ModelGetCategoryTreeRequest{Levels: 2})
+	if err != nil {
+		t.Fatalf("GetCategoryTree: %v", err)
+	}
+	if want, got := db.RootCategory, tree.Root.Id; want != got {
+		t.Fatalf("tree root is %q, wanted %q", got, want)
+	}
+	if want, got := 2, len(tree.Root.Children); want != got {
+		t.Fatalf("root has %d children, wanted %d", got, want)
+	}
+
+	// Retrieve only the hardware category.
+	tree, err = model.GetCategoryTree(ctx, &spb.ModelGetCategoryTreeRequest{Id: hardware})
+	if err != nil {
+		t.Fatalf("GetCategoryTree(hardware): %v", err)
+	}
+	if want, got := 0, len(tree.Root.Children); want != got {
+		t.Fatalf("hardware has %d children at level 0, wanted %d", got, want)
+	}
+
+	// Rename and re-parent network under software.
+	_, err = model.UpdateCategory(ctx, &spb.ModelUpdateCategoryRequest{
+		Id:          network,
+		Name:        "networking",
+		ParentId:    software,
+		Description: &spb.ModelUpdateCategoryRequest_MaybeString{Value: "Networking software"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateCategory(network): %v", err)
+	}
+	tree, err = model.GetCategoryTree(ctx, &spb.ModelGetCategoryTreeRequest{Id: software, Levels: 1})
+	if err != nil {
+		t.Fatalf("GetCategoryTree(software): %v", err)
+	}
+	if want, got := 1, len(tree.Root.Children); want != got {
+		t.Fatalf("software has %d children, wanted %d", got, want)
+	}
+	if want, got := "networking", tree.Root.Children[0].Name; want != got {
+		t.Fatalf("software child is %q, wanted %q", got, want)
+	}
+	if want, got := "Networking software", tree.Root.Children[0].Description; want != got {
+		t.Fatalf("software child description is %q, wanted %q", got, want)
+	}
+
+	// Moving a category under its own descendant is rejected.
+	_, err = model.UpdateCategory(ctx, &spb.ModelUpdateCategoryRequest{
+		Id:       software,
+		ParentId: network,
+	})
+	if want, got := codes.InvalidArgument, status.Code(err); want != got {
+		t.Fatalf("UpdateCategory(cycle): wanted %v, got %v", want, got)
+	}
+
+	// Non-leaf categories cannot be deleted, leaf categories can.
+	_, err = model.DeleteCategory(ctx, &spb.ModelDeleteCategoryRequest{Id: software})
+	if want, got := codes.FailedPrecondition, status.Code(err); want != got {
+		t.Fatalf("DeleteCategory(non-leaf): wanted %v, got %v", want, got)
+	}
+	_, err = model.DeleteCategory(ctx, &spb.ModelDeleteCategoryRequest{Id: network})
+	if err != nil {
+		t.Fatalf("DeleteCategory(leaf): %v", err)
+	}
+	_, err = model.DeleteCategory(ctx, &spb.ModelDeleteCategoryRequest{Id: network})
+	if want, got := codes.NotFound, status.Code(err); want != got {
+		t.Fatalf("DeleteCategory(deleted): wanted %v, got %v", want, got)
+	}
+}
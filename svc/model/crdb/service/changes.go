@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchChunkSize is the maximum amount of changes retrieved from the database
+// (and sent to the client) at once in WatchChanges.
+const watchChunkSize = 100
+
+// encodeChangeCursor returns an opaque cursor for a change position.
+func encodeChangeCursor(p *db.IssueChangePosition) string {
+	s := fmt.Sprintf("%s/%d/%d", p.CommitTS, p.IssueID, p.UpdateID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// decodeChangeCursor parses a cursor returned by encodeChangeCursor.
+func decodeChangeCursor(c string) (*db.IssueChangePosition, error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encoding")
+	}
+	parts := strings.Split(string(b), "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid format")
+	}
+	p := &db.IssueChangePosition{CommitTS: parts[0]}
+	// The commit timestamp is a decimal, but it's only ever passed back to
+	// the database - just ensure it's not garbage.
+	if strings.Trim(p.CommitTS, "0123456789.") != "" || p.CommitTS == "" {
+		return nil, fmt.Errorf("invalid timestamp")
+	}
+	if p.IssueID, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid issue")
+	}
+	if p.UpdateID, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid update")
+	}
+	return p, nil
+}
+
+func (s *Service) WatchChanges(req *spb.ModelWatchChangesRequest, srv spb.Model_WatchChangesServer) error {
+	ctx := srv.Context()
+
+	var after *db.IssueChangePosition
+	if req.Cursor != "" {
+		var err error
+		after, err = decodeChangeCursor(req.Cursor)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "cursor: %v", err)
+		}
+	}
+
+	// Subscribe before first reading changes, so that no change committed in
+	// between gets missed. See live.go for the general mechanism.
+	wake, unsubscribe := s.updates.subscribe(anyIssue)
+	defer unsubscribe()
+
+	interval := s.opts.LivePollInterval
+	if interval == 0 {
+		interval = defaultLivePollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := s.db.Do(ctx).Issue().GetChanges(after, watchChunkSize)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			chunk := &spb.ModelWatchChangesChunk{}
+			for _, c := range changes {
+				change := &spb.ModelWatchChangesChunk_Change{
+					Cursor:  encodeChangeCursor(&c.IssueChangePosition),
+					IssueId: c.IssueID,
+					Kind:    spb.ModelWatchChangesChunk_Change_KIND_ISSUE_CREATED,
+				}
+				if c.Update != nil {
+					change.Kind = spb.ModelWatchChangesChunk_Change_KIND_ISSUE_UPDATED
+					change.Update = c.Update.Proto()
+				}
+				chunk.Changes = append(chunk.Changes, change)
+			}
+			if err := srv.Send(chunk); err != nil {
+				return err
+			}
+			after = &changes[len(changes)-1].IssueChangePosition
+		}
+		// More changes are immediately available, don't wait.
+		if len(changes) == watchChunkSize {
+			continue
+		}
+		if !req.Follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+)
+
+func TestChangeCursor(t *testing.T) {
+	p := &db.IssueChangePosition{
+		CommitTS: "1592568000123456789.0000000001",
+		IssueID:  1337,
+		UpdateID: 42,
+	}
+	got, err := decodeChangeCursor(encodeChangeCursor(p))
+	if err != nil {
+		t.Fatalf("decodeChangeCursor: %v", err)
+	}
+	if *got != *p {
+		t.Fatalf("cursor roundtrip: wanted %+v, got %+v", p, got)
+	}
+
+	for _, c := range []string{
+		"garbage!",
+		encodeChangeCursor(&db.IssueChangePosition{CommitTS: "1; DROP TABLE issues"}),
+		"MTIzLzQ1Ng",
+	} {
+		if _, err := decodeChangeCursor(c); err == nil {
+			t.Errorf("decodeChangeCursor(%q) should have failed", c)
+		}
+	}
+}
+
+func TestWatchChanges(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkIssue := func() int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: 2,
+				Status:   cpb.IssueStatus_NEW,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	update := func(id int64, comment string) {
+		_, err := model.UpdateIssue(ctx, &spb.ModelUpdateIssueRequest{
+			Id:      id,
+			Author:  users["implr"],
+			Comment: comment,
+		})
+		if err != nil {
+			t.Fatalf("UpdateIssue: %v", err)
+		}
+	}
+	watch := func(ctx context.Context, cursor string, follow bool) spb.Model_WatchChangesClient {
+		srv, err := model.WatchChanges(ctx, &spb.ModelWatchChangesRequest{
+			Cursor: cursor,
+			Follow: follow,
+		})
+		if err != nil {
+			t.Fatalf("WatchChanges: %v", err)
+		}
+		return srv
+	}
+	receiveAll := func(srv spb.Model_WatchChangesClient) []*spb.ModelWatchChangesChunk_Change {
+		var res []*spb.ModelWatchChangesChunk_Change
+		for {
+			chunk, err := srv.Recv()
+			if err == io.EOF {
+				return res
+			}
+			if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+			res = append(res, chunk.Changes...)
+		}
+	}
+
+	i1 := mkIssue()
+	i2 := mkIssue()
+	update(i1, "first")
+	update(i2, "second")
+
+	changes := receiveAll(watch(ctx, "", false))
+	if want, got := 4, len(changes); want != got {
+		t.Fatalf("wanted %d changes, got %d", want, got)
+	}
+	for i, want := range []struct {
+		issue   int64
+		kind    spb.ModelWatchChangesChunk_Change_Kind
+		comment string
+	}{
+		{i1, spb.ModelWatchChangesChunk_Change_KIND_ISSUE_CREATED, ""},
+		{i2, spb.ModelWatchChangesChunk_Change_KIND_ISSUE_CREATED, ""},
+		{i1, spb.ModelWatchChangesChunk_Change_KIND_ISSUE_UPDATED, "first"},
+		{i2, spb.ModelWatchChangesChunk_Change_KIND_ISSUE_UPDATED, "second"},
+	} {
+		got := changes[i]
+		if got.IssueId != want.issue || got.Kind != want.kind || got.Update.GetComment() != want.comment {
+			t.Errorf("change %d: wanted %d/%s/%q, got %d/%s/%q", i, want.issue, want.kind, want.comment, got.IssueId, got.Kind, got.Update.GetComment())
+		}
+	}
+
+	// Resuming from a cursor returns only the following changes.
+	resumed := receiveAll(watch(ctx, changes[2].Cursor, false))
+	if want, got := 1, len(resumed); want != got {
+		t.Fatalf("wanted %d changes after resume, got %d", want, got)
+	}
+	if want, got := changes[3].Cursor, resumed[0].Cursor; want != got {
+		t.Fatalf("resumed change has cursor %q, wanted %q", got, want)
+	}
+
+	// Following the feed returns new changes as they happen.
+	fctx, fctxC := context.WithCancel(ctx)
+	defer fctxC()
+	srv := watch(fctx, changes[3].Cursor, true)
+	received := make(chan *spb.ModelWatchChangesChunk_Change)
+	go func() {
+		defer close(received)
+		for {
+			chunk, err := srv.Recv()
+			if err != nil {
+				return
+			}
+			for _, c := range chunk.Changes {
+				received <- c
+			}
+		}
+	}()
+	i3 := mkIssue()
+	select {
+	case c := <-received:
+		if c.IssueId != i3 || c.Kind != spb.ModelWatchChangesChunk_Change_KIND_ISSUE_CREATED {
+			t.Fatalf("wanted creation of %d, got %v", i3, c)
+		}
+	case <-time.After(defaultLivePollInterval / 2):
+		t.Fatalf("new change not received")
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/search"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultCompletions is the amount of completions returned if not
+	// requested otherwise.
+	defaultCompletions = 10
+	// maxCompletions is the maximum amount of completions that can be
+	// requested.
+	maxCompletions = 100
+)
+
+// userFields are fields whose values are usernames.
+var userFields = map[string]bool{
+	"author": true, "assignee": true, "cc": true, "commenter": true,
+}
+
+// rankCompletions returns the candidates matching a typed prefix, ignoring
+// case: exact matches first, then ones starting with the prefix, then ones
+// containing it. Otherwise, candidates keep their order.
+func rankCompletions(prefix string, candidates []string) []string {
+	prefix = strings.ToLower(prefix)
+	var exact, prefixed, containing []string
+	for _, c := range candidates {
+		lc := strings.ToLower(c)
+		switch {
+		case lc == prefix:
+			exact = append(exact, c)
+		case strings.HasPrefix(lc, prefix):
+			prefixed = append(prefixed, c)
+		case strings.Contains(lc, prefix):
+			containing = append(containing, c)
+		}
+	}
+	return append(append(exact, prefixed...), containing...)
+}
+
+func (s *Service) CompleteQuery(ctx context.Context, req *spb.ModelCompleteQueryRequest) (*spb.ModelCompleteQueryResponse, error) {
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultCompletions
+	case limit < 0 || limit > maxCompletions:
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", maxCompletions)
+	}
+	if req.Cursor < 0 || req.Cursor > int64(len(req.Query)) {
+		return nil, status.Error(codes.InvalidArgument, "cursor must be within query")
+	}
+
+	c := search.CompleteAt(req.Query, int(req.Cursor))
+	res := &spb.ModelCompleteQueryResponse{
+		Start: int64(c.Span.Start),
+		End:   int64(c.Span.End),
+	}
+	add := func(kind spb.ModelCompleteQueryResponse_Completion_Kind, texts ...string) {
+		for _, t := range texts {
+			if int64(len(res.Completions)) >= limit {
+				return
+			}
+			res.Completions = append(res.Completions, &spb.ModelCompleteQueryResponse_Completion{
+				Kind: kind,
+				Text: t,
+			})
+		}
+	}
+
+	if c.Kind == search.CompletionField {
+		for _, f := range rankCompletions(c.Prefix, search.Fields) {
+			add(spb.ModelCompleteQueryResponse_Completion_KIND_FIELD, f+":")
+		}
+		return res, nil
+	}
+
+	// Only equality filters have completable values.
+	if c.Kind != search.CompletionValue || c.Comparison != search.ComparisonEqual {
+		return res, nil
+	}
+	switch c.Key {
+	case "status":
+		add(spb.ModelCompleteQueryResponse_Completion_KIND_VALUE, rankCompletions(c.Prefix, search.IssueStatusKeywords)...)
+	case "is":
+		add(spb.ModelCompleteQueryResponse_Completion_KIND_VALUE, rankCompletions(c.Prefix, search.IssueStatusGroupKeywords)...)
+	case "type":
+		add(spb.ModelCompleteQueryResponse_Completion_KIND_VALUE, rankCompletions(c.Prefix, search.IssueTypeKeywords)...)
+	case "has":
+		add(spb.ModelCompleteQueryResponse_Completion_KIND_VALUE, rankCompletions(c.Prefix, []string{"assignee"})...)
+	case "sort":
+		// Keep the minus of descending sort keys.
+		prefix := strings.TrimPrefix(c.Prefix, "-")
+		direction := c.Prefix[:len(c.Prefix)-len(prefix)]
+		var fields []string
+		for f := range sortFields {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		for _, f := range rankCompletions(prefix, fields) {
+			add(spb.ModelCompleteQueryResponse_Completion_KIND_VALUE, direction+f)
+		}
+	default:
+		if !userFields[c.Key] {
+			break
+		}
+		users, err := s.db.Do(ctx).User().GetByUsernamePrefix(c.Prefix, limit)
+		if err != nil {
+			s.l.Error("GetByUsernamePrefix failed", "prefix", c.Prefix, "err", err)
+			return nil, status.Error(codes.Unavailable, "could not retrieve users")
+		}
+		for _, u := range users {
+			add(spb.ModelCompleteQueryResponse_Completion_KIND_USER, u.Username)
+		}
+	}
+	return res, nil
+}
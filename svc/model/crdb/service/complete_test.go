@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	spb "github.com/q3k/bugless/proto/svc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRankCompletions(t *testing.T) {
+	candidates := []string{"fixed", "new", "fixed_verified", "wontfix_infeasible", "Fix"}
+	for i, te := range []struct {
+		prefix string
+		want   string
+	}{
+		{"", "[fixed new fixed_verified wontfix_infeasible Fix]"},
+		{"fix", "[Fix fixed fixed_verified wontfix_infeasible]"},
+		{"FIXED", "[fixed fixed_verified]"},
+		{"verified", "[fixed_verified]"},
+		{"foo", "[]"},
+	} {
+		if want, got := te.want, fmt.Sprintf("%v", rankCompletions(te.prefix, candidates)); want != got {
+			t.Errorf("test %d: wanted %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestCompleteQuery(t *testing.T) {
+	ctx := context.Background()
+
+	model, _, cancel := dutModel()
+	defer cancel()
+
+	if _, err := model.NewUser(ctx, &spb.ModelNewUserRequest{Username: "q3k2"}); err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+
+	for i, te := range []struct {
+		// query is the query, with the cursor marked by a '|'.
+		query string
+		limit int64
+		want  string
+	}{
+		{"stat|", 0, "[KIND_FIELD:status:]"},
+		{"foo -assig|", 0, "[KIND_FIELD:assignee:]"},
+		{"|", 3, "[KIND_FIELD:status: KIND_FIELD:assignee: KIND_FIELD:author:]"},
+		{"status:new,fix|", 0, "[KIND_VALUE:fixed KIND_VALUE:fixed_verified]"},
+		{"type:sec|", 0, "[KIND_VALUE:security]"},
+		{"is:|", 0, "[KIND_VALUE:open KIND_VALUE:closed]"},
+		{"sort:-prio|", 0, "[KIND_VALUE:-priority]"},
+		{"author:q3|", 0, "[KIND_USER:q3k KIND_USER:q3k2]"},
+		{"cc:q3k|", 1, "[KIND_USER:q3k]"},
+		{"assignee:|", 0, "[KIND_USER:implr KIND_USER:q3k KIND_USER:q3k2]"},
+		{"priority<|", 0, "[]"},
+		{"title:|", 0, "[]"},
+	} {
+		cursor := strings.Index(te.query, "|")
+		res, err := model.CompleteQuery(ctx, &spb.ModelCompleteQueryRequest{
+			Query:  te.query[:cursor] + te.query[cursor+1:],
+			Cursor: int64(cursor),
+			Limit:  te.limit,
+		})
+		if err != nil {
+			t.Fatalf("test %d: CompleteQuery: %v", i, err)
+		}
+		var got []string
+		for _, c := range res.Completions {
+			got = append(got, fmt.Sprintf("%s:%s", c.Kind, c.Text))
+		}
+		if want, got := te.want, fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted %s, got %s", i, want, got)
+		}
+	}
+
+	for i, req := range []*spb.ModelCompleteQueryRequest{
+		{Query: "foo", Cursor: 4},
+		{Query: "foo", Cursor: -1},
+		{Query: "foo", Cursor: 3, Limit: 1000},
+	} {
+		_, err := model.CompleteQuery(ctx, req)
+		if want, got := codes.InvalidArgument, status.Code(err); want != got {
+			t.Errorf("test %d: wanted %v, got %v", i, want, got)
+		}
+	}
+}
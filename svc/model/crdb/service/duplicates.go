@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/search"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultDuplicates is the amount of duplicate suggestions returned if
+	// not requested otherwise.
+	defaultDuplicates = 10
+	// maxDuplicates is the maximum amount of duplicate suggestions that can be
+	// requested.
+	maxDuplicates = 100
+)
+
+func (s *Service) SuggestDuplicates(ctx context.Context, req *spb.ModelSuggestDuplicatesRequest) (*spb.ModelSuggestDuplicatesResponse, error) {
+	if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Body) == "" {
+		return nil, status.Error(codes.InvalidArgument, "title or body must be set")
+	}
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultDuplicates
+	case limit < 0 || limit > maxDuplicates:
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", maxDuplicates)
+	}
+	if req.ExcludeIssueId < 0 {
+		return nil, status.Error(codes.InvalidArgument, "exclude_issue_id must be valid")
+	}
+	if s.opts.Search == nil {
+		return nil, status.Error(codes.Unimplemented, "duplicate suggestions unavailable")
+	}
+
+	similar, err := s.opts.Search.SuggestDuplicates(ctx, &spb.SuggestDuplicatesRequest{
+		Title:          req.Title,
+		Body:           req.Body,
+		Limit:          limit,
+		ExcludeIssueId: req.ExcludeIssueId,
+	})
+	if err != nil {
+		s.l.Error("Search.SuggestDuplicates failed", "err", err)
+		return nil, status.Error(codes.Unavailable, "duplicate search failed")
+	}
+	res := &spb.ModelSuggestDuplicatesResponse{}
+	if len(similar.Suggestions) == 0 {
+		return res, nil
+	}
+
+	// The Search index might lag behind, so issues are checked to (still)
+	// exist and be open.
+	scores := make(map[int64]float64)
+	filter := db.IssueFilter{}
+	for _, sg := range similar.Suggestions {
+		scores[sg.IssueId] = sg.Score
+		filter.IDs = append(filter.IDs, sg.IssueId)
+	}
+	for _, st := range search.ParseIssueStatusGroup("open") {
+		filter.Statuses = append(filter.Statuses, int64(st))
+	}
+	issues, err := s.db.Do(ctx).Issue().Filter(filter, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		return scores[issues[i].ID] > scores[issues[j].ID]
+	})
+
+	for _, issue := range issues {
+		ip, err := issue.ProtoWithUsers(s.db.Do(ctx))
+		if err != nil {
+			s.l.Error("ProtoWithUsers failed", "err", err)
+			return nil, status.Error(codes.Internal, "database entry for issue could not be parsed")
+		}
+		res.Suggestions = append(res.Suggestions, &spb.ModelSuggestDuplicatesResponse_Suggestion{
+			Issue: ip,
+			Score: scores[issue.ID],
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSuggestDuplicates(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	search := &fakeSearch{}
+	model, users, cancel := dutModelWithOptions(Options{
+		Search: dutSearch(ctx, search),
+	})
+	defer cancel()
+
+	mkIssue := func(st cpb.IssueStatus) int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: 2,
+				Status:   st,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	i1 := mkIssue(cpb.IssueStatus_NEW)
+	i2 := mkIssue(cpb.IssueStatus_FIXED)
+	i3 := mkIssue(cpb.IssueStatus_ACCEPTED)
+	// Most similar first, including a closed issue and an issue that doesn't
+	// exist in the model (anymore).
+	search.duplicates = []int64{i3, 1337, i2, i1}
+
+	for i, te := range []struct {
+		req  *spb.ModelSuggestDuplicatesRequest
+		want []int64
+		code codes.Code
+	}{
+		{&spb.ModelSuggestDuplicatesRequest{Title: "foo"}, []int64{i3, i1}, codes.OK},
+		{&spb.ModelSuggestDuplicatesRequest{Body: "foo", ExcludeIssueId: i3}, []int64{i1}, codes.OK},
+		{&spb.ModelSuggestDuplicatesRequest{Title: "foo", Limit: 1}, []int64{i3}, codes.OK},
+		{&spb.ModelSuggestDuplicatesRequest{Title: " "}, nil, codes.InvalidArgument},
+		{&spb.ModelSuggestDuplicatesRequest{Title: "foo", Limit: 1000}, nil, codes.InvalidArgument},
+	} {
+		res, err := model.SuggestDuplicates(ctx, te.req)
+		if want, got := te.code, status.Code(err); want != got {
+			t.Errorf("test %d: wanted %v, got %v (%v)", i, want, got, err)
+			continue
+		}
+		if te.code != codes.OK {
+			continue
+		}
+		var got []int64
+		for _, sg := range res.Suggestions {
+			got = append(got, sg.Issue.Id)
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"time"
 
+	cpb "github.com/q3k/bugless/proto/common"
 	spb "github.com/q3k/bugless/proto/svc"
 	"github.com/q3k/bugless/svc/model/common/validation"
 	"github.com/q3k/bugless/svc/model/crdb/db"
@@ -22,6 +23,9 @@ func (s *Service) NewIssue(ctx context.Context, req *spb.ModelNewIssueRequest) (
 	defer session.Rollback()
 
 	i := req.InitialState
+	if err := s.resolveRequestUsers(session, req.Author, append([]*cpb.User{i.Assignee}, i.Cc...)...); err != nil {
+		return nil, err
+	}
 
 	now := time.Now()
 
@@ -29,6 +33,14 @@ func (s *Service) NewIssue(ctx context.Context, req *spb.ModelNewIssueRequest) (
 	if i.Assignee != nil {
 		assignee = i.Assignee.Id
 	}
+	category := ""
+	if i.Category != nil {
+		category = i.Category.Id
+	}
+	var cc []string
+	for _, u := range i.Cc {
+		cc = append(cc, u.Id)
+	}
 	issue, err := session.Issue().New(&db.Issue{
 		AuthorID:    req.Author.Id,
 		Created:     now.UnixNano(),
@@ -38,6 +50,8 @@ func (s *Service) NewIssue(ctx context.Context, req *spb.ModelNewIssueRequest) (
 		Type:        int64(i.Type),
 		Priority:    i.Priority,
 		Status:      int64(i.Status),
+		CategoryID:  category,
+		CCIDs:       cc,
 	})
 
 	if err != nil {
@@ -54,9 +68,12 @@ func (s *Service) NewIssue(ctx context.Context, req *spb.ModelNewIssueRequest) (
 		}
 	}
 
-	res := &spb.ModelNewIssueResponse{
-		Id: issue.ID,
+	if err := session.Commit(); err != nil {
+		return nil, err
 	}
+	s.updates.notify(issue.ID)
 
-	return res, session.Commit()
+	return &spb.ModelNewIssueResponse{
+		Id: issue.ID,
+	}, nil
 }
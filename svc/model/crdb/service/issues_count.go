@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultFacetLimit is the amount of values returned for every facet if
+	// not requested otherwise.
+	defaultFacetLimit = 10
+	// maxFacetLimit is the maximum amount of values that can be requested for
+	// every facet.
+	maxFacetLimit = 100
+)
+
+func (s *Service) CountIssues(ctx context.Context, req *spb.ModelCountIssuesRequest) (*spb.ModelCountIssuesResponse, error) {
+	limit := req.FacetLimit
+	switch {
+	case limit == 0:
+		limit = defaultFacetLimit
+	case limit < 0 || limit > maxFacetLimit:
+		return nil, status.Errorf(codes.InvalidArgument, "facet_limit must be between 0 and %d", maxFacetLimit)
+	}
+
+	q, err := s.parseSearch(req.Search)
+	if err != nil {
+		return nil, err
+	}
+	c, filter, err := s.compileSearch(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	res := &spb.ModelCountIssuesResponse{
+		QueryErrors: queryErrorsProto(append(q.Errors, c.errors...)),
+	}
+	if filter == nil {
+		return res, nil
+	}
+
+	// All counts are taken within a single transaction, so that they're
+	// consistent with each other.
+	session := s.db.Begin(ctx)
+	defer session.Rollback()
+
+	res.Total, err = session.Issue().Count(*filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// counts retrieves a facet and calls add for every value in it.
+	counts := func(facet db.IssueFacet, add func(value string, count int64) error) error {
+		values, err := session.Issue().CountBy(*filter, facet, limit)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if err := add(v.Value, v.Count); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// number parses a numeric facet value.
+	number := func(value string) (int64, error) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			s.l.Error("invalid facet value", "value", value, "err", err)
+			return 0, status.Error(codes.Internal, "database facet could not be parsed")
+		}
+		return n, nil
+	}
+
+	err = counts(db.IssueFacetStatus, func(value string, count int64) error {
+		n, err := number(value)
+		if err != nil {
+			return err
+		}
+		res.Statuses = append(res.Statuses, &spb.ModelCountIssuesResponse_StatusCount{
+			Status: cpb.IssueStatus(n),
+			Count:  count,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = counts(db.IssueFacetType, func(value string, count int64) error {
+		n, err := number(value)
+		if err != nil {
+			return err
+		}
+		res.Types = append(res.Types, &spb.ModelCountIssuesResponse_TypeCount{
+			Type:  cpb.IssueType(n),
+			Count: count,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = counts(db.IssueFacetPriority, func(value string, count int64) error {
+		n, err := number(value)
+		if err != nil {
+			return err
+		}
+		res.Priorities = append(res.Priorities, &spb.ModelCountIssuesResponse_PriorityCount{
+			Priority: n,
+			Count:    count,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = counts(db.IssueFacetAssignee, func(value string, count int64) error {
+		ac := &spb.ModelCountIssuesResponse_AssigneeCount{
+			Count: count,
+		}
+		if value != db.UnassignedUUID {
+			user, err := session.User().Get(value)
+			if err != nil {
+				return err
+			}
+			ac.Assignee = user.Proto()
+		}
+		res.Assignees = append(res.Assignees, ac)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = counts(db.IssueFacetCategory, func(value string, count int64) error {
+		category, err := session.Category().Get(value)
+		if err != nil {
+			return err
+		}
+		res.Categories = append(res.Categories, &spb.ModelCountIssuesResponse_CategoryCount{
+			Category: category.Proto(),
+			Count:    count,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, session.Commit()
+}
@@ -1,7 +1,8 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -47,89 +48,98 @@ func (s *Service) getIssueById(req *spb.ModelGetIssuesRequest_ById, srv spb.Mode
 func (s *Service) getIssuesBySearch(req *spb.ModelGetIssuesRequest, reqs *spb.ModelGetIssuesRequest_BySearch, srv spb.Model_GetIssuesServer) error {
 	ctx := srv.Context()
 
-	reqs.Search = strings.TrimSpace(reqs.Search)
-	if reqs.Search == "" {
-		return status.Error(codes.InvalidArgument, "search must be set and non-empty")
+	q, err := s.parseSearch(reqs.Search)
+	if err != nil {
+		return err
 	}
-	q := search.ParseSearch(reqs.Search)
-	s.l.Debug("query by search", "query", q)
 
-	// Try to parse ID, if given. Otherwise will be 0.
-	var id int64
-	if idStr := strings.TrimSpace(q.ID); idStr != "" {
-		id_, err := strconv.ParseInt(idStr, 10, 64)
-		if err == nil {
-			id = id_
+	// Simple case: if the query is just an ID set to a valid number, that's
+	// just a get-by-id.
+	if q.Expr.Op == search.OpTerm && q.Expr.Term.Key == "id" {
+		id, err := strconv.ParseInt(strings.TrimSpace(q.Expr.Term.Value), 10, 64)
+		if err == nil && id != 0 {
+			return s.getIssueById(&spb.ModelGetIssuesRequest_ById{Id: id}, srv)
 		}
 	}
 
-	// Simple case: if the ID is set to a valid number, that's just a get-by-id.
-	if id != 0 {
-		return s.getIssueById(&spb.ModelGetIssuesRequest_ById{Id: id}, srv)
+	c, filter, err := s.compileSearch(ctx, q)
+	if err != nil {
+		return err
 	}
+	sorts := c.ordering(req, q)
+	// Problems found while parsing come before those found while compiling.
+	queryErrors := queryErrorsProto(append(q.Errors, c.errors...))
 
-	var err error
-	var queryErrors []string
-	// Query cannot return any results, because filter requested datum that is
-	// known not to exist (ie. a user that could not be resolved).
-	var queryImpossible bool
-
-	author := strings.ToLower(strings.TrimSpace(q.Author))
-	authorID := ""
-	// TODO(q3k): cache these lookups
-	if author != "" {
-		authorID, err = s.db.Do(ctx).User().ResolveUsername(author)
+	// Snippets are the ones found by the Search service for the top-level
+	// keywords, which have already been searched for while compiling the
+	// query (unless it turned out to be impossible).
+	var snippets map[int64]*spb.QueryResponse_Fragments
+	if filter != nil && len(q.Keywords) > 0 {
+		hits, err := c.keywords(q.Keywords)
 		if err != nil {
-			if err == db.UserErrorNoSuchUsername {
-				queryErrors = append(queryErrors, fmt.Sprintf("unknown author %q", author))
-				queryImpossible = true
-			} else {
-				s.l.Error("ResolveUser failed", "username", author, "err", err)
-			}
+			return err
 		}
+		snippets = hits.snippets
 	}
 
-	assignee := strings.ToLower(strings.TrimSpace(q.Assignee))
-	assigneeID := ""
-	if assignee != "" {
-		assigneeID, err = s.db.Do(ctx).User().ResolveUsername(assignee)
-		if err != nil {
-			if err == db.UserErrorNoSuchUsername {
-				queryErrors = append(queryErrors, fmt.Sprintf("unknown assignee %q", assignee))
-				queryImpossible = true
-			} else {
-				s.l.Error("ResolveUser failed", "username", author, "err", err)
+	var orderBy []db.IssueOrderBy
+	for _, o := range sorts {
+		if o.By == spb.ModelGetIssuesRequest_ORDER_BY_RELEVANCE {
+			if len(sorts) > 1 || o.Descending {
+				return status.Error(codes.InvalidArgument, "relevance ordering cannot be descending or combined with other sort keys")
+			}
+			if len(q.Keywords) == 0 {
+				return status.Error(codes.InvalidArgument, "relevance ordering requires keywords")
+			}
+			hits, err := c.keywords(q.Keywords)
+			if err != nil {
+				return err
 			}
+			return s.getIssuesByRelevance(req, filter, hits, queryErrors, srv)
 		}
+		by, ok := issueOrders[o.By]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "invalid order_by (%s)", o.By.String())
+		}
+		orderBy = append(orderBy, db.IssueOrderBy{Ascending: !o.Descending, By: by})
 	}
 
-	filter := db.IssueFilter{
-		Author:   authorID,
-		Assignee: assigneeID,
-		Status:   int64(search.ParseIssueStatus(q.Status)),
+	// position returns the database position of an issue from a page token.
+	position := func(t *pagination.Token) *db.IssuePosition {
+		if t == nil {
+			return nil
+		}
+		return &db.IssuePosition{Key: t.Key, ID: t.ID}
 	}
-	if !queryImpossible && filter.Author == "" && filter.Assignee == "" && filter.Status == 0 {
-		return status.Error(codes.Unimplemented, "keyword search unimplemented, use query filters")
+	// token returns the page token of an issue, ie. its position in the
+	// ordering.
+	token := func(issue *db.Issue) *pagination.Token {
+		p := issue.Position(orderBy)
+		return &pagination.Token{Key: p.Key, ID: p.ID}
 	}
 
-	orderBy := db.IssueOrderBy{
-		Ascending: true,
-	}
-	switch req.OrderBy {
-	case spb.ModelGetIssuesRequest_ORDER_BY_CREATED:
-		orderBy.By = db.IssueOrderCreated
-	case spb.ModelGetIssuesRequest_ORDER_BY_LAST_UPDATE:
-		orderBy.By = db.IssueOrderUpdated
-	default:
-		return status.Errorf(codes.InvalidArgument, "invalid order_by (%s)", req.OrderBy.String())
+	locate := func(before *pagination.Token, n int64) (*pagination.Token, error) {
+		if filter == nil {
+			return nil, nil
+		}
+		opts := db.IssueFilterOpts{After: position(before), Count: n, Reverse: true}
+		issues, err := s.db.Do(ctx).Issue().Filter(*filter, orderBy, &opts)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(issues)) < n {
+			return nil, nil
+		}
+		return token(issues[n-1]), nil
 	}
 
-	return pagination.ResampleInt64(req.Pagination, func(first bool, start pagination.V, count int64) (int, pagination.V, error) {
-
+	// The pagination value is the page token of the last returned issue.
+	return pagination.ResampleToken(req.Pagination, locate, func(first bool, start pagination.V, count int64) (int, pagination.V, error) {
+		after := start.(*pagination.Token)
 		var issues []*db.Issue
-		if !queryImpossible {
-			opts := db.IssueFilterOpts{Start: start.(int64), Count: count}
-			issues, err = s.db.Do(ctx).Issue().Filter(filter, orderBy, &opts)
+		if filter != nil {
+			opts := db.IssueFilterOpts{After: position(after), Count: count}
+			issues, err = s.db.Do(ctx).Issue().Filter(*filter, orderBy, &opts)
 			if err != nil {
 				return 0, start, err
 			}
@@ -138,6 +148,11 @@ func (s *Service) getIssuesBySearch(req *spb.ModelGetIssuesRequest, reqs *spb.Mo
 		chunk := &spb.ModelGetIssuesChunk{}
 		if first {
 			chunk.QueryErrors = queryErrors
+			var firstIssue *pagination.Token
+			if len(issues) > 0 {
+				firstIssue = token(issues[0])
+			}
+			chunk.PrevPageToken = pagination.PrevPageToken(after, firstIssue)
 		}
 		for _, issue := range issues {
 			ip, err := issue.ProtoWithUsers(s.db.Do(ctx))
@@ -146,11 +161,172 @@ func (s *Service) getIssuesBySearch(req *spb.ModelGetIssuesRequest, reqs *spb.Mo
 				return 0, start, status.Error(codes.Internal, "database entry for issue could not be parsed")
 			}
 			chunk.Issues = append(chunk.Issues, ip)
+			addSnippets(chunk, snippets, issue.ID)
 		}
 
 		if len(issues) > 0 {
-			start = issues[len(issues)-1].Created
+			start = token(issues[len(issues)-1])
+		}
+		if int64(len(issues)) == count {
+			chunk.NextPageToken = start.(*pagination.Token).Encode()
 		}
 		return len(issues), start, srv.Send(chunk)
 	})
 }
+
+// parseSearch parses a non-empty search query.
+func (s *Service) parseSearch(query string) (*search.Query, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "search must be set and non-empty")
+	}
+	q := search.ParseSearch(query)
+	s.l.Debug("query by search", "query", q.Expr)
+	if q.Expr == nil {
+		return nil, status.Error(codes.InvalidArgument, "query must contain filters or keywords")
+	}
+	return q, nil
+}
+
+// compileSearch compiles a parsed search query into a database filter.
+// Keywords are resolved into a list of matching issues by the Search service,
+// ordered by relevance. This list is then used as an extra filter on the
+// database query. A nil filter means that the query cannot return any
+// results. Problems found while compiling are recorded in the returned
+// compiler.
+func (s *Service) compileSearch(ctx context.Context, q *search.Query) (*queryCompiler, *db.IssueFilter, error) {
+	c := newQueryCompiler(ctx, s)
+	filter, err := c.compile(q.Expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.terms == 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "query must contain filters or keywords")
+	}
+	return c, filter, nil
+}
+
+// issueOrders maps request orderings to database orderings. Relevance
+// ordering is not done by the database.
+var issueOrders = map[spb.ModelGetIssuesRequest_OrderBy]db.IssueOrder{
+	spb.ModelGetIssuesRequest_ORDER_BY_CREATED:     db.IssueOrderCreated,
+	spb.ModelGetIssuesRequest_ORDER_BY_LAST_UPDATE: db.IssueOrderUpdated,
+	spb.ModelGetIssuesRequest_ORDER_BY_PRIORITY:    db.IssueOrderPriority,
+	spb.ModelGetIssuesRequest_ORDER_BY_STATUS:      db.IssueOrderStatus,
+	spb.ModelGetIssuesRequest_ORDER_BY_TYPE:        db.IssueOrderType,
+	spb.ModelGetIssuesRequest_ORDER_BY_ASSIGNEE:    db.IssueOrderAssignee,
+	spb.ModelGetIssuesRequest_ORDER_BY_TITLE:       db.IssueOrderTitle,
+}
+
+// addSnippets adds the snippets of an issue to a chunk, if there are any.
+func addSnippets(chunk *spb.ModelGetIssuesChunk, snippets map[int64]*spb.QueryResponse_Fragments, id int64) {
+	sn, ok := snippets[id]
+	if !ok {
+		return
+	}
+	if chunk.Snippets == nil {
+		chunk.Snippets = make(map[int64]*spb.QueryResponse_Fragments)
+	}
+	chunk.Snippets[id] = sn
+}
+
+// getIssuesByRelevance serves a search query ordered by relevance, given the
+// issues matching the query keywords. The pagination value is a page token
+// keyed by the (1-indexed) relevance rank of the last returned issue. A nil
+// filter means that the query cannot return any results.
+func (s *Service) getIssuesByRelevance(req *spb.ModelGetIssuesRequest, filter *db.IssueFilter, hits *keywordHits, queryErrors []*spb.QueryError, srv spb.Model_GetIssuesServer) error {
+	ctx := srv.Context()
+
+	rank := make(map[int64]int64)
+	for i, id := range hits.ids {
+		rank[id] = int64(i + 1)
+	}
+
+	// The amount of issues is bounded by the amount of keyword hits, so we
+	// retrieve all of them at once and order them in memory.
+	var issues []*db.Issue
+	if filter != nil {
+		var err error
+		issues, err = s.db.Do(ctx).Issue().Filter(*filter, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		return rank[issues[i].ID] < rank[issues[j].ID]
+	})
+
+	// rankOf returns the relevance rank from a page token, or zero if the
+	// token is nil.
+	rankOf := func(t *pagination.Token) (int64, error) {
+		if t == nil {
+			return 0, nil
+		}
+		if len(t.Key) == 1 {
+			if r, ok := t.Key[0].(int64); ok {
+				return r, nil
+			}
+		}
+		return 0, status.Error(codes.InvalidArgument, "invalid pagination 'after': not a relevance ordering token")
+	}
+	token := func(issue *db.Issue) *pagination.Token {
+		return &pagination.Token{Key: []interface{}{rank[issue.ID]}, ID: issue.ID}
+	}
+	// following returns the index of the first issue following a rank.
+	following := func(r int64) int {
+		return sort.Search(len(issues), func(i int) bool {
+			return rank[issues[i].ID] > r
+		})
+	}
+
+	locate := func(before *pagination.Token, n int64) (*pagination.Token, error) {
+		r, err := rankOf(before)
+		if err != nil {
+			return nil, err
+		}
+		// Index of the first issue at or after the rank.
+		i := int64(following(r - 1))
+		if i < n {
+			return nil, nil
+		}
+		return token(issues[i-n]), nil
+	}
+
+	return pagination.ResampleToken(req.Pagination, locate, func(first bool, start pagination.V, count int64) (int, pagination.V, error) {
+		after, err := rankOf(start.(*pagination.Token))
+		if err != nil {
+			return 0, start, err
+		}
+		page := issues[following(after):]
+		if int64(len(page)) > count {
+			page = page[:count]
+		}
+
+		chunk := &spb.ModelGetIssuesChunk{}
+		if first {
+			chunk.QueryErrors = queryErrors
+			var firstIssue *pagination.Token
+			if len(page) > 0 {
+				firstIssue = token(page[0])
+			}
+			chunk.PrevPageToken = pagination.PrevPageToken(start.(*pagination.Token), firstIssue)
+		}
+		for _, issue := range page {
+			ip, err := issue.ProtoWithUsers(s.db.Do(ctx))
+			if err != nil {
+				s.l.Error("ProtoWithUsers failed", "err", err)
+				return 0, start, status.Error(codes.Internal, "database entry for issue could not be parsed")
+			}
+			chunk.Issues = append(chunk.Issues, ip)
+			addSnippets(chunk, hits.snippets, issue.ID)
+		}
+
+		if len(page) > 0 {
+			start = token(page[len(page)-1])
+		}
+		if int64(len(page)) == count {
+			chunk.NextPageToken = start.(*pagination.Token).Encode()
+		}
+		return len(page), start, srv.Send(chunk)
+	})
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
 
 	cpb "github.com/q3k/bugless/proto/common"
 	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestIssueCreationSelectionStream(t *testing.T) {
@@ -161,4 +166,820 @@ func TestIssueUpdating(t *testing.T) {
 	if want, got := 1337, i; want != got {
 		t.Fatalf("wanted %d updates, got %d", want, got)
 	}
+
+	// Retrieve all updates, page by page.
+	i = 0
+	after := ""
+	for {
+		srv, err := model.GetIssueUpdates(ctx, &spb.ModelGetIssueUpdatesRequest{
+			Id:   res.Id,
+			Mode: spb.ModelGetIssueUpdatesRequest_MODE_STATUS_AND_UPDATES,
+			Pagination: &spb.PaginationSelector{
+				After: after,
+				Count: 500,
+			},
+		})
+		if err != nil {
+			t.Fatalf("GetIssueUpdates: %v", err)
+		}
+		after = ""
+		for {
+			chunk, err := srv.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Recv: %v", err)
+			}
+			for _, update := range chunk.Updates {
+				if want, got := updateComment(i), update.Comment; want != got {
+					t.Fatalf("update %d: wanted comment %q, got %q", i, want, got)
+				}
+				i++
+			}
+			after = chunk.NextPageToken
+		}
+		if after == "" {
+			break
+		}
+	}
+	if want, got := 1337, i; want != got {
+		t.Fatalf("wanted %d updates, got %d", want, got)
+	}
+}
+
+func TestIssueCategorySearch(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkCategory := func(parent, name string) string {
+		res, err := model.NewCategory(ctx, &spb.ModelNewCategoryRequest{
+			ParentId: parent,
+			Name:     name,
+		})
+		if err != nil {
+			t.Fatalf("NewCategory(%q): %v", name, err)
+		}
+		return res.Id
+	}
+	hardware := mkCategory(db.RootCategory, "hardware")
+	network := mkCategory(hardware, "network")
+	switches := mkCategory(network, "switches")
+	storage := mkCategory(hardware, "storage")
+
+	mkIssue := func(category string) int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: 2,
+				Status:   cpb.IssueStatus_NEW,
+				Category: &cpb.Category{Id: category},
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	inNetwork := mkIssue(network)
+	inSwitches := mkIssue(switches)
+	inStorage := mkIssue(storage)
+
+	// Move the storage issue to switches.
+	_, err := model.UpdateIssue(ctx, &spb.ModelUpdateIssueRequest{
+		Id:     inStorage,
+		Author: users["q3k"],
+		Diff: &cpb.IssueStateDiff{
+			Category: &cpb.Category{Id: switches},
+		},
+	})
+	if err != nil {
+		t.Fatalf("UpdateIssue: %v", err)
+	}
+
+	for i, te := range []struct {
+		query  string
+		want   []int64
+		errors int
+	}{
+		{"category:hardware/network", []int64{inNetwork, inSwitches, inStorage}, 0},
+		{"category:Hardware/Network/Switches", []int64{inSwitches, inStorage}, 0},
+		{"category:hardware/storage", []int64{}, 0},
+		{"category:hardware/nonexistent", []int64{}, 1},
+	} {
+		srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+			Query: &spb.ModelGetIssuesRequest_BySearch_{
+				BySearch: &spb.ModelGetIssuesRequest_BySearch{
+					Search: te.query,
+				},
+			},
+			OrderBy: spb.ModelGetIssuesRequest_ORDER_BY_CREATED,
+		})
+		if err != nil {
+			t.Fatalf("test %d: GetIssues: %v", i, err)
+		}
+		var got []int64
+		var errors int
+		for {
+			chunk, err := srv.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("test %d: Recv: %v", i, err)
+			}
+			errors += len(chunk.QueryErrors)
+			for _, issue := range chunk.Issues {
+				got = append(got, issue.Id)
+			}
+		}
+		if want, got := te.errors, errors; want != got {
+			t.Errorf("test %d: wanted %d query errors, got %d", i, want, got)
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestIssueCC(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+		Author: users["q3k"],
+		InitialState: &cpb.IssueState{
+			Title:    "test issue",
+			Type:     cpb.IssueType_BUG,
+			Priority: 2,
+			Status:   cpb.IssueStatus_NEW,
+			Cc:       []*cpb.User{{Username: "implr"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewIssue: %v", err)
+	}
+	id := res.Id
+
+	// Swap implr for q3k.
+	_, err = model.UpdateIssue(ctx, &spb.ModelUpdateIssueRequest{
+		Id:     id,
+		Author: users["q3k"],
+		Diff: &cpb.IssueStateDiff{
+			CcAdded:   []*cpb.User{users["q3k"]},
+			CcRemoved: []*cpb.User{users["implr"]},
+		},
+	})
+	if err != nil {
+		t.Fatalf("UpdateIssue: %v", err)
+	}
+	_, err = model.UpdateIssue(ctx, &spb.ModelUpdateIssueRequest{
+		Id:     id,
+		Author: users["q3k"],
+		Diff: &cpb.IssueStateDiff{
+			CcAdded:   []*cpb.User{users["implr"]},
+			CcRemoved: []*cpb.User{users["implr"]},
+		},
+	})
+	if want, got := codes.InvalidArgument, status.Code(err); want != got {
+		t.Fatalf("UpdateIssue(add and remove): wanted %v, got %v", want, got)
+	}
+
+	// The CC list is returned with the issue...
+	srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+		Query: &spb.ModelGetIssuesRequest_ById_{
+			ById: &spb.ModelGetIssuesRequest_ById{Id: id},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetIssues: %v", err)
+	}
+	chunk, err := srv.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	cc := chunk.Issues[0].Current.Cc
+	if len(cc) != 1 || cc[0].Username != "q3k" {
+		t.Fatalf("wanted cc list [q3k], got %v", cc)
+	}
+
+	// ... and the changes are recorded in the update log.
+	usrv, err := model.GetIssueUpdates(ctx, &spb.ModelGetIssueUpdatesRequest{Id: id})
+	if err != nil {
+		t.Fatalf("GetIssueUpdates: %v", err)
+	}
+	uchunk, err := usrv.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if want, got := 1, len(uchunk.Updates); want != got {
+		t.Fatalf("wanted %d updates, got %d", want, got)
+	}
+	diff := uchunk.Updates[0].Diff
+	if len(diff.CcAdded) != 1 || diff.CcAdded[0].Id != users["q3k"].Id {
+		t.Errorf("wanted cc_added [q3k], got %v", diff.CcAdded)
+	}
+	if len(diff.CcRemoved) != 1 || diff.CcRemoved[0].Id != users["implr"].Id {
+		t.Errorf("wanted cc_removed [implr], got %v", diff.CcRemoved)
+	}
+
+	// Issues can be searched by CC.
+	for i, te := range []struct {
+		query string
+		want  []int64
+	}{
+		{"cc:q3k", []int64{id}},
+		{"cc:implr", []int64{}},
+	} {
+		srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+			Query: &spb.ModelGetIssuesRequest_BySearch_{
+				BySearch: &spb.ModelGetIssuesRequest_BySearch{
+					Search: te.query,
+				},
+			},
+			OrderBy: spb.ModelGetIssuesRequest_ORDER_BY_CREATED,
+		})
+		if err != nil {
+			t.Fatalf("test %d: GetIssues: %v", i, err)
+		}
+		var got []int64
+		for {
+			chunk, err := srv.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("test %d: Recv: %v", i, err)
+			}
+			for _, issue := range chunk.Issues {
+				got = append(got, issue.Id)
+			}
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
+
+// searchIssues runs a search query ordered by creation, and returns the IDs of
+// all matching issues and the amount of query errors.
+func searchIssues(ctx context.Context, t *testing.T, model spb.ModelClient, query string) ([]int64, int) {
+	t.Helper()
+	srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+		Query: &spb.ModelGetIssuesRequest_BySearch_{
+			BySearch: &spb.ModelGetIssuesRequest_BySearch{
+				Search: query,
+			},
+		},
+		OrderBy: spb.ModelGetIssuesRequest_ORDER_BY_CREATED,
+	})
+	if err != nil {
+		t.Fatalf("GetIssues(%q): %v", query, err)
+	}
+	var ids []int64
+	var errors int
+	for {
+		chunk, err := srv.Recv()
+		if err == io.EOF {
+			return ids, errors
+		}
+		if err != nil {
+			t.Fatalf("GetIssues(%q): Recv: %v", query, err)
+		}
+		errors += len(chunk.QueryErrors)
+		for _, issue := range chunk.Issues {
+			ids = append(ids, issue.Id)
+		}
+	}
+}
+
+func TestIssueBooleanSearch(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkIssue := func(author string, assignee *cpb.User, st cpb.IssueStatus) int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users[author],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: 2,
+				Status:   st,
+				Assignee: assignee,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	newByQ3k := mkIssue("q3k", nil, cpb.IssueStatus_NEW)
+	assignedToImplr := mkIssue("q3k", users["implr"], cpb.IssueStatus_ASSIGNED)
+	assignedToQ3k := mkIssue("implr", users["q3k"], cpb.IssueStatus_ASSIGNED)
+	fixedByImplr := mkIssue("implr", users["implr"], cpb.IssueStatus_FIXED)
+
+	for i, te := range []struct {
+		query  string
+		want   []int64
+		errors int
+	}{
+		{"status:new OR status:assigned", []int64{newByQ3k, assignedToImplr, assignedToQ3k}, 0},
+		{"status:assigned -assignee:q3k", []int64{assignedToImplr}, 0},
+		{"-(status:new OR status:assigned)", []int64{fixedByImplr}, 0},
+		{"author:implr AND (status:fixed OR assignee:q3k)", []int64{assignedToQ3k, fixedByImplr}, 0},
+		{"(author:q3k assignee:implr) OR (author:implr assignee:implr)", []int64{assignedToImplr, fixedByImplr}, 0},
+		// Filters on nonexistent data only fail their own branch of the query.
+		{"author:nobody OR status:fixed", []int64{fixedByImplr}, 1},
+		{"author:implr -assignee:nobody", []int64{assignedToQ3k, fixedByImplr}, 1},
+		{"author:nobody status:new", []int64{}, 1},
+	} {
+		got, errors := searchIssues(ctx, t, model, te.query)
+		if want, got := te.errors, errors; want != got {
+			t.Errorf("test %d: wanted %d query errors, got %d", i, want, got)
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestIssueComparisonSearch(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	var issues []int64
+	for priority := int64(0); priority < 4; priority++ {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: priority,
+				Status:   cpb.IssueStatus_NEW,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		issues = append(issues, res.Id)
+	}
+
+	for i, te := range []struct {
+		query  string
+		want   []int64
+		errors int
+	}{
+		{"priority<2", issues[:2], 0},
+		{"priority<=2", issues[:3], 0},
+		{"priority>2", issues[3:], 0},
+		{"priority>=2", issues[2:], 0},
+		{"priority:1", issues[1:2], 0},
+		{"priority:1..P2", issues[1:3], 0},
+		{"priority:..1 OR priority:3..", []int64{issues[0], issues[1], issues[3]}, 0},
+		// All issues have been created today.
+		{"created:-0d priority<1", issues[:1], 0},
+		{"created>=2020-06-01 priority<1", issues[:1], 0},
+		{"created<-0d", []int64{}, 0},
+		{"updated>-1h priority<1", issues[:1], 0},
+		{"updated:..-1d", []int64{}, 0},
+		{"priority<high", []int64{}, 1},
+		{"updated>yesterday", []int64{}, 1},
+		{"author>q3k", []int64{}, 1},
+	} {
+		got, errors := searchIssues(ctx, t, model, te.query)
+		if want, got := te.errors, errors; want != got {
+			t.Errorf("test %d: wanted %d query errors, got %d", i, want, got)
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestIssueFieldSearch(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkIssue := func(title string, typ cpb.IssueType, assignee *cpb.User) int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    title,
+				Type:     typ,
+				Priority: 2,
+				Status:   cpb.IssueStatus_NEW,
+				Assignee: assignee,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	crash := mkIssue("Crash on startup", cpb.IssueType_BUG, nil)
+	progress := mkIssue("Show 100% progress", cpb.IssueType_FEATURE_REQUEST, users["implr"])
+	cleanup := mkIssue("Remove startup_legacy", cpb.IssueType_INTERNAL_CLEANUP, users["q3k"])
+
+	// Only updates with comments make their authors commenters.
+	for _, c := range []struct {
+		id       int64
+		author   string
+		comment  string
+		priority int64
+	}{
+		{crash, "implr", "I can reproduce this.", 0},
+		{progress, "q3k", "", 3},
+		{progress, "implr", "", 1},
+	} {
+		req := &spb.ModelUpdateIssueRequest{
+			Id:      c.id,
+			Author:  users[c.author],
+			Comment: c.comment,
+		}
+		if c.priority != 0 {
+			req.Diff = &cpb.IssueStateDiff{Priority: &cpb.IssueStateDiff_MaybeInt64{Value: c.priority}}
+		}
+		if _, err := model.UpdateIssue(ctx, req); err != nil {
+			t.Fatalf("UpdateIssue: %v", err)
+		}
+	}
+
+	for i, te := range []struct {
+		query  string
+		want   []int64
+		errors int
+	}{
+		{"type:bug", []int64{crash}, 0},
+		{"type:feature OR type:internal_cleanup", []int64{progress, cleanup}, 0},
+		{"title:startup", []int64{crash, cleanup}, 0},
+		{"title:\"100%\"", []int64{progress}, 0},
+		{"title:p_l", []int64{}, 0},
+		{"title:startup_", []int64{cleanup}, 0},
+		{"p:1", []int64{progress}, 0},
+		{"has:assignee", []int64{progress, cleanup}, 0},
+		{"-has:assignee type:bug", []int64{crash}, 0},
+		{"commenter:implr", []int64{crash}, 0},
+		{"commenter:q3k", []int64{}, 0},
+		{"type:feature OR type:bugfix", []int64{progress}, 1},
+		{"has:comments", []int64{}, 1},
+		{"reporter:q3k OR type:bug", []int64{crash}, 1},
+	} {
+		got, errors := searchIssues(ctx, t, model, te.query)
+		if want, got := te.errors, errors; want != got {
+			t.Errorf("test %d: wanted %d query errors, got %d", i, want, got)
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestIssueListSearch(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkIssue := func(assignee *cpb.User, st cpb.IssueStatus, priority int64) int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: priority,
+				Status:   st,
+				Assignee: assignee,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	newIssue := mkIssue(nil, cpb.IssueStatus_NEW, 0)
+	accepted := mkIssue(users["q3k"], cpb.IssueStatus_ACCEPTED, 1)
+	fixed := mkIssue(users["implr"], cpb.IssueStatus_FIXED, 2)
+	verified := mkIssue(users["q3k"], cpb.IssueStatus_FIXED_VERIFIED, 3)
+	obsolete := mkIssue(users["implr"], cpb.IssueStatus_WONTFIX_OBSOLETE, 4)
+
+	for i, te := range []struct {
+		query  string
+		want   []int64
+		errors int
+	}{
+		{"is:open", []int64{newIssue, accepted}, 0},
+		{"is:closed", []int64{fixed, verified, obsolete}, 0},
+		{"-is:open", []int64{fixed, verified, obsolete}, 0},
+		{"is:open,closed", []int64{newIssue, accepted, fixed, verified, obsolete}, 0},
+		{"status:fixed,fixed_verified", []int64{fixed, verified}, 0},
+		{"is:closed assignee:q3k,implr -status:obsolete", []int64{fixed, verified}, 0},
+		{"priority:0,3..", []int64{newIssue, verified, obsolete}, 0},
+		{fmt.Sprintf("id:%d,%d", newIssue, fixed), []int64{newIssue, fixed}, 0},
+		{"status:new,bogus", []int64{newIssue}, 1},
+		{"assignee:nobody,q3k is:open", []int64{accepted}, 1},
+		{"is:stale", []int64{}, 1},
+		{"status:,", []int64{}, 1},
+	} {
+		got, errors := searchIssues(ctx, t, model, te.query)
+		if want, got := te.errors, errors; want != got {
+			t.Errorf("test %d: wanted %d query errors, got %d", i, want, got)
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestIssueQueryErrors(t *testing.T) {
+	ctx := context.Background()
+
+	model, _, cancel := dutModel()
+	defer cancel()
+
+	query := `author:nobody bar:baz priority<x (status:new`
+	srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+		Query: &spb.ModelGetIssuesRequest_BySearch_{
+			BySearch: &spb.ModelGetIssuesRequest_BySearch{
+				Search: query,
+			},
+		},
+		OrderBy: spb.ModelGetIssuesRequest_ORDER_BY_CREATED,
+	})
+	if err != nil {
+		t.Fatalf("GetIssues: %v", err)
+	}
+	chunk, err := srv.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	// Parser warnings first, then compiler errors in query order.
+	want := []string{
+		`SEVERITY_WARNING 33-34 "missing ')'"`,
+		`SEVERITY_ERROR 7-13 "unknown author \"nobody\""`,
+		`SEVERITY_ERROR 14-17 "unknown field \"bar\""`,
+		`SEVERITY_ERROR 31-32 "invalid priority \"x\""`,
+	}
+	var got []string
+	for _, e := range chunk.QueryErrors {
+		got = append(got, fmt.Sprintf("%s %d-%d %q", e.Severity, e.Start, e.End, e.Message))
+	}
+	if want, got := strings.Join(want, "\n"), strings.Join(got, "\n"); want != got {
+		t.Errorf("wanted query errors:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestIssueSortSearch(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkIssue := func(title string, assignee *cpb.User, priority int64) int64 {
+		st := cpb.IssueStatus_NEW
+		if assignee != nil {
+			st = cpb.IssueStatus_ASSIGNED
+		}
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    title,
+				Type:     cpb.IssueType_BUG,
+				Priority: priority,
+				Status:   st,
+				Assignee: assignee,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	a := mkIssue("a", users["q3k"], 2)
+	b := mkIssue("b", nil, 1)
+	c := mkIssue("c", users["implr"], 2)
+	d := mkIssue("d", nil, 2)
+	e := mkIssue("e", users["implr"], 1)
+
+	// getPage retrieves a page of issues matching a query, returning them
+	// and the previous and next page tokens.
+	getPage := func(query string, sort []*spb.ModelGetIssuesRequest_Sort, after string, count int64) (ids []int64, prev, next string) {
+		srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+			Query: &spb.ModelGetIssuesRequest_BySearch_{
+				BySearch: &spb.ModelGetIssuesRequest_BySearch{
+					Search: query,
+				},
+			},
+			OrderBy:    spb.ModelGetIssuesRequest_ORDER_BY_CREATED,
+			Sort:       sort,
+			Pagination: &spb.PaginationSelector{After: after, Count: count},
+		})
+		if err != nil {
+			t.Fatalf("GetIssues(%q): %v", query, err)
+		}
+		for i := 0; ; i++ {
+			chunk, err := srv.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetIssues(%q): Recv: %v", query, err)
+			}
+			for _, issue := range chunk.Issues {
+				ids = append(ids, issue.Id)
+			}
+			if i == 0 {
+				prev = chunk.PrevPageToken
+			}
+			next = chunk.NextPageToken
+		}
+	}
+	// getAll retrieves all issues matching a query, count issues at a time,
+	// going forwards through all pages and then backwards from the last one.
+	getAll := func(query string, sort []*spb.ModelGetIssuesRequest_Sort, count int64) (forwards, backwards []int64) {
+		var last []int64
+		var prev string
+		after := ""
+		for {
+			ids, p, next := getPage(query, sort, after, count)
+			forwards = append(forwards, ids...)
+			last, prev = ids, p
+			if next == "" {
+				break
+			}
+			after = next
+		}
+		backwards = last
+		for prev != "" {
+			var ids []int64
+			ids, prev, _ = getPage(query, sort, prev, count)
+			backwards = append(ids, backwards...)
+		}
+		return forwards, backwards
+	}
+
+	for i, te := range []struct {
+		query string
+		sort  []*spb.ModelGetIssuesRequest_Sort
+		want  []int64
+	}{
+		{"type:bug", nil, []int64{a, b, c, d, e}},
+		{"type:bug sort:-title", nil, []int64{e, d, c, b, a}},
+		{"type:bug sort:priority,-created", nil, []int64{e, b, d, c, a}},
+		{"type:bug sort:-priority", nil, []int64{a, c, d, b, e}},
+		{"type:bug sort:assignee,-priority", nil, []int64{d, b, c, e, a}},
+		{"type:bug sort:status,title", nil, []int64{b, d, a, c, e}},
+		{"type:bug", []*spb.ModelGetIssuesRequest_Sort{
+			{By: spb.ModelGetIssuesRequest_ORDER_BY_PRIORITY, Descending: true},
+			{By: spb.ModelGetIssuesRequest_ORDER_BY_TITLE, Descending: true},
+		}, []int64{d, c, a, e, b}},
+		// Sort directives override the request ordering.
+		{"type:bug sort:title", []*spb.ModelGetIssuesRequest_Sort{
+			{By: spb.ModelGetIssuesRequest_ORDER_BY_PRIORITY},
+		}, []int64{a, b, c, d, e}},
+	} {
+		for _, count := range []int64{100, 2, 1} {
+			forwards, backwards := getAll(te.query, te.sort, count)
+			if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", forwards); want != got {
+				t.Errorf("test %d, count %d: wanted issues %s, got %s", i, count, want, got)
+			}
+			if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", backwards); want != got {
+				t.Errorf("test %d, count %d: wanted issues %s going backwards, got %s", i, count, want, got)
+			}
+		}
+	}
+
+	// Unknown sort fields are reported, and the request ordering is used
+	// instead.
+	got, errors := searchIssues(ctx, t, model, "type:bug sort:-bogus")
+	if want, got := 1, errors; want != got {
+		t.Errorf("wanted %d query errors, got %d", want, got)
+	}
+	if want, got := fmt.Sprintf("%v", []int64{a, b, c, d, e}), fmt.Sprintf("%v", got); want != got {
+		t.Errorf("wanted issues %s, got %s", want, got)
+	}
+}
+
+func TestIssueCounts(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	mkIssue := func(assignee *cpb.User, typ cpb.IssueType, priority int64) {
+		st := cpb.IssueStatus_NEW
+		if assignee != nil {
+			st = cpb.IssueStatus_ASSIGNED
+		}
+		_, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users["q3k"],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     typ,
+				Priority: priority,
+				Status:   st,
+				Assignee: assignee,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+	}
+	mkIssue(users["q3k"], cpb.IssueType_BUG, 2)
+	mkIssue(users["implr"], cpb.IssueType_BUG, 1)
+	mkIssue(users["implr"], cpb.IssueType_BUG, 2)
+	mkIssue(nil, cpb.IssueType_BUG, 2)
+	mkIssue(nil, cpb.IssueType_FEATURE_REQUEST, 2)
+	mkIssue(nil, cpb.IssueType_BUG, 3)
+	mkIssue(nil, cpb.IssueType_BUG, 1)
+
+	// facets formats all facets of a response as a string.
+	facets := func(res *spb.ModelCountIssuesResponse) string {
+		var parts []string
+		for _, c := range res.Statuses {
+			parts = append(parts, fmt.Sprintf("%s:%d", c.Status, c.Count))
+		}
+		for _, c := range res.Types {
+			parts = append(parts, fmt.Sprintf("%s:%d", c.Type, c.Count))
+		}
+		for _, c := range res.Priorities {
+			parts = append(parts, fmt.Sprintf("P%d:%d", c.Priority, c.Count))
+		}
+		for _, c := range res.Assignees {
+			username := "-"
+			if c.Assignee != nil {
+				username = c.Assignee.Username
+			}
+			parts = append(parts, fmt.Sprintf("%s:%d", username, c.Count))
+		}
+		for _, c := range res.Categories {
+			name := c.Category.Id
+			if name == db.RootCategory {
+				name = "root"
+			}
+			parts = append(parts, fmt.Sprintf("%s:%d", name, c.Count))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	for i, te := range []struct {
+		query  string
+		limit  int64
+		total  int64
+		want   string
+		errors int
+	}{
+		{"priority>0", 0, 7, "NEW:4 ASSIGNED:3 BUG:6 FEATURE_REQUEST:1 P2:4 P1:2 P3:1 -:4 implr:2 q3k:1 root:7", 0},
+		{"priority>0", 1, 7, "NEW:4 BUG:6 P2:4 -:4 root:7", 0},
+		{"assignee:implr", 0, 2, "ASSIGNED:2 BUG:2 P1:1 P2:1 implr:2 root:2", 0},
+		{"type:feature_request OR priority:3", 0, 2, "NEW:2 BUG:1 FEATURE_REQUEST:1 P2:1 P3:1 -:2 root:2", 0},
+		{"status:new priority:5", 0, 0, "", 0},
+		{"assignee:nonexistent", 0, 0, "", 1},
+	} {
+		res, err := model.CountIssues(ctx, &spb.ModelCountIssuesRequest{
+			Search:     te.query,
+			FacetLimit: te.limit,
+		})
+		if err != nil {
+			t.Fatalf("test %d: CountIssues(%q): %v", i, te.query, err)
+		}
+		if want, got := te.total, res.Total; want != got {
+			t.Errorf("test %d: wanted total %d, got %d", i, want, got)
+		}
+		if want, got := te.want, facets(res); want != got {
+			t.Errorf("test %d: wanted facets %q, got %q", i, want, got)
+		}
+		if want, got := te.errors, len(res.QueryErrors); want != got {
+			t.Errorf("test %d: wanted %d query errors, got %d", i, want, got)
+		}
+	}
+
+	for i, te := range []struct {
+		query string
+		limit int64
+	}{
+		{"", 0},
+		{"priority>0", -1},
+		{"priority>0", 1000},
+	} {
+		_, err := model.CountIssues(ctx, &spb.ModelCountIssuesRequest{
+			Search:     te.query,
+			FacetLimit: te.limit,
+		})
+		if want, got := codes.InvalidArgument, status.Code(err); want != got {
+			t.Errorf("test %d: wanted %v, got %v", i, want, got)
+		}
+	}
 }
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	spb "github.com/q3k/bugless/proto/svc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxKeywordHits is the maximum amount of issues retrieved from the Search
+// service for a single query.
+const maxKeywordHits = 1000
+
+// searchQuery builds a Search service query string that requires all the given
+// keywords to be present. Every keyword is treated as a phrase, so that no
+// query syntax can be smuggled in through keywords.
+func searchQuery(keywords []string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	parts := make([]string, len(keywords))
+	for i, k := range keywords {
+		parts[i] = `+"` + escaper.Replace(k) + `"`
+	}
+	return strings.Join(parts, " ")
+}
+
+// keywordHits are the issues matching keywords.
+type keywordHits struct {
+	// ids of the matching issues, most relevant first.
+	ids []int64
+	// snippets are excerpts of the comments of matching issues which contain
+	// the keywords, by issue ID.
+	snippets map[int64]*spb.QueryResponse_Fragments
+	// truncated is set if more documents match the keywords than were
+	// retrieved, ie. ids doesn't contain all matching issues.
+	truncated bool
+}
+
+// searchKeywords returns the issues matching all the given keywords.
+func (s *Service) searchKeywords(ctx context.Context, keywords []string) (*keywordHits, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srv, err := s.opts.Search.Query(ctx, &spb.QueryRequest{
+		Query:    searchQuery(keywords),
+		PageSize: maxKeywordHits,
+	})
+	if err != nil {
+		s.l.Error("Search.Query failed", "err", err)
+		return nil, status.Error(codes.Unavailable, "keyword search failed")
+	}
+
+	res := &keywordHits{
+		snippets: make(map[int64]*spb.QueryResponse_Fragments),
+	}
+	seen := make(map[int64]bool)
+	// received is the amount of documents (issues and comments) retrieved,
+	// total the amount of documents matching the query.
+	received, total := uint64(0), uint64(0)
+	for len(res.ids) < maxKeywordHits {
+		chunk, err := srv.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.l.Error("Search.Query failed", "err", err)
+			return nil, status.Error(codes.Unavailable, "keyword search failed")
+		}
+		received += uint64(len(chunk.Results))
+		total = chunk.TotalHits
+		for _, r := range chunk.Results {
+			if r.Kind != spb.QueryResponse_Result_KIND_ISSUE {
+				continue
+			}
+			id := r.GetIssue().GetId()
+			if id == 0 || seen[id] {
+				continue
+			}
+			seen[id] = true
+			res.ids = append(res.ids, id)
+			if f := r.FragmentsByField["comments"]; len(f.GetFragments()) > 0 {
+				res.snippets[id] = f
+			}
+		}
+	}
+	if len(res.ids) > maxKeywordHits {
+		res.ids = res.ids[:maxKeywordHits]
+		res.truncated = true
+	}
+	if received < total {
+		res.truncated = true
+	}
+	return res, nil
+}
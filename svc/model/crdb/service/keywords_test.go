@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/search"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSearch is a Search service that returns canned issue IDs for queries.
+type fakeSearch struct {
+	results map[string][]int64
+	// comments are the texts of comment fragments returned for issues.
+	comments map[int64]string
+	// duplicates are the issue IDs suggested as duplicates of any draft,
+	// most similar first.
+	duplicates []int64
+	// totals are the total hits reported for queries, if they match more
+	// documents than returned.
+	totals map[string]uint64
+}
+
+func (f *fakeSearch) Query(req *spb.QueryRequest, srv spb.Search_QueryServer) error {
+	res := &spb.QueryResponse{
+		TotalHits: f.totals[req.Query],
+	}
+	for _, id := range f.results[req.Query] {
+		result := &spb.QueryResponse_Result{
+			Kind: spb.QueryResponse_Result_KIND_ISSUE,
+			Payload: &spb.QueryResponse_Result_Issue{
+				Issue: &spb.QueryResponse_Issue{Id: id},
+			},
+		}
+		if comment, ok := f.comments[id]; ok {
+			result.FragmentsByField = map[string]*spb.QueryResponse_Fragments{
+				"comments": {Fragments: []*spb.QueryResponse_Fragment{{Text: comment}}},
+			}
+		}
+		res.Results = append(res.Results, result)
+	}
+	return srv.Send(res)
+}
+
+func (f *fakeSearch) IndexIssue(ctx context.Context, req *spb.IndexIssueRequest) (*spb.IndexIssueResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func (f *fakeSearch) IndexUpdate(ctx context.Context, req *spb.IndexUpdateRequest) (*spb.IndexUpdateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func (f *fakeSearch) SuggestDuplicates(ctx context.Context, req *spb.SuggestDuplicatesRequest) (*spb.SuggestDuplicatesResponse, error) {
+	res := &spb.SuggestDuplicatesResponse{}
+	for i, id := range f.duplicates {
+		if id == req.ExcludeIssueId || int64(len(res.Suggestions)) >= req.Limit {
+			continue
+		}
+		res.Suggestions = append(res.Suggestions, &spb.SuggestDuplicatesResponse_Suggestion{
+			IssueId: id,
+			Score:   float64(len(f.duplicates) - i),
+		})
+	}
+	return res, nil
+}
+
+func (f *fakeSearch) GetIndexInfo(ctx context.Context, req *spb.GetIndexInfoRequest) (*spb.GetIndexInfoResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func (f *fakeSearch) DeleteIssue(ctx context.Context, req *spb.DeleteIssueRequest) (*spb.DeleteIssueResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func (f *fakeSearch) DeleteUpdate(ctx context.Context, req *spb.DeleteUpdateRequest) (*spb.DeleteUpdateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func (f *fakeSearch) GetIndexStats(ctx context.Context, req *spb.GetIndexStatsRequest) (*spb.GetIndexStatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func (f *fakeSearch) MigrateKeys(ctx context.Context, req *spb.MigrateKeysRequest) (*spb.MigrateKeysResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "unimplemented in fake")
+}
+
+func TestSearchQuery(t *testing.T) {
+	for i, te := range []struct {
+		keywords []string
+		want     string
+	}{
+		{[]string{"foo"}, `+"foo"`},
+		{[]string{"foo", "bar baz"}, `+"foo" +"bar baz"`},
+		{[]string{`title:"foo\`}, `+"title:\"foo\\"`},
+	} {
+		if want, got := te.want, searchQuery(te.keywords); want != got {
+			t.Errorf("test %d: wanted %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestKeywordSearch(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	search := &fakeSearch{
+		results:  make(map[string][]int64),
+		comments: make(map[int64]string),
+	}
+	model, users, cancel := dutModelWithOptions(Options{
+		Search: dutSearch(ctx, search),
+	})
+	defer cancel()
+
+	mkIssue := func(author string) int64 {
+		res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: users[author],
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Type:     cpb.IssueType_BUG,
+				Priority: 2,
+				Status:   cpb.IssueStatus_NEW,
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		return res.Id
+	}
+	i1 := mkIssue("q3k")
+	i2 := mkIssue("implr")
+	i3 := mkIssue("q3k")
+	// Most relevant first, including an issue that doesn't exist in the
+	// model (anymore).
+	search.results[`+"foo"`] = []int64{i3, 1337, i2, i1}
+	search.comments[i2] = "a comment about foo"
+
+	for i, te := range []struct {
+		query   string
+		orderBy spb.ModelGetIssuesRequest_OrderBy
+		want    []int64
+		code    codes.Code
+	}{
+		{"foo", spb.ModelGetIssuesRequest_ORDER_BY_CREATED, []int64{i1, i2, i3}, codes.OK},
+		{"foo", spb.ModelGetIssuesRequest_ORDER_BY_RELEVANCE, []int64{i3, i2, i1}, codes.OK},
+		{"foo author:q3k", spb.ModelGetIssuesRequest_ORDER_BY_RELEVANCE, []int64{i3, i1}, codes.OK},
+		{"bar author:q3k", spb.ModelGetIssuesRequest_ORDER_BY_CREATED, []int64{}, codes.OK},
+		{"author:q3k", spb.ModelGetIssuesRequest_ORDER_BY_RELEVANCE, nil, codes.InvalidArgument},
+	} {
+		srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+			Query: &spb.ModelGetIssuesRequest_BySearch_{
+				BySearch: &spb.ModelGetIssuesRequest_BySearch{
+					Search: te.query,
+				},
+			},
+			OrderBy: te.orderBy,
+		})
+		if err != nil {
+			t.Fatalf("test %d: GetIssues: %v", i, err)
+		}
+		var got []int64
+		var snippets []string
+		for {
+			chunk, err := srv.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if want, got := te.code, status.Code(err); want != got {
+					t.Errorf("test %d: wanted %v, got %v", i, want, got)
+				}
+				break
+			}
+			for _, issue := range chunk.Issues {
+				got = append(got, issue.Id)
+				for _, f := range chunk.Snippets[issue.Id].GetFragments() {
+					snippets = append(snippets, fmt.Sprintf("%d:%s", issue.Id, f.Text))
+				}
+			}
+		}
+		if te.code != codes.OK {
+			continue
+		}
+		if want, got := fmt.Sprintf("%v", te.want), fmt.Sprintf("%v", got); want != got {
+			t.Errorf("test %d: wanted issues %s, got %s", i, want, got)
+		}
+		// Only issues with matching comments have snippets.
+		var wantSnippets []string
+		for _, id := range te.want {
+			if id == i2 {
+				wantSnippets = append(wantSnippets, fmt.Sprintf("%d:a comment about foo", i2))
+			}
+		}
+		if want, got := fmt.Sprintf("%v", wantSnippets), fmt.Sprintf("%v", snippets); want != got {
+			t.Errorf("test %d: wanted snippets %s, got %s", i, want, got)
+		}
+	}
+
+	// Relevance-ordered results can be paginated.
+	getPage := func(after string) *spb.ModelGetIssuesChunk {
+		srv, err := model.GetIssues(ctx, &spb.ModelGetIssuesRequest{
+			Query: &spb.ModelGetIssuesRequest_BySearch_{
+				BySearch: &spb.ModelGetIssuesRequest_BySearch{
+					Search: "foo",
+				},
+			},
+			OrderBy: spb.ModelGetIssuesRequest_ORDER_BY_RELEVANCE,
+			Pagination: &spb.PaginationSelector{
+				After: after,
+				Count: 1,
+			},
+		})
+		if err != nil {
+			t.Fatalf("GetIssues: %v", err)
+		}
+		chunk, err := srv.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		return chunk
+	}
+	first := getPage("")
+	if len(first.Issues) != 1 || first.Issues[0].Id != i3 {
+		t.Fatalf("wanted first page to be [%d], got %v", i3, first.Issues)
+	}
+	second := getPage(first.NextPageToken)
+	if len(second.Issues) != 1 || second.Issues[0].Id != i2 {
+		t.Fatalf("wanted second page to be [%d], got %v", i2, second.Issues)
+	}
+}
+
+func TestKeywordTruncation(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	fake := &fakeSearch{
+		results: make(map[string][]int64),
+		totals:  make(map[string]uint64),
+	}
+	for i := int64(1); i <= maxKeywordHits; i++ {
+		fake.results[`+"foo" +"bar"`] = append(fake.results[`+"foo" +"bar"`], i)
+	}
+	fake.totals[`+"foo" +"bar"`] = maxKeywordHits + 500
+	fake.results[`+"baz"`] = []int64{1, 2, 3}
+	fake.totals[`+"baz"`] = 3
+	s := &Service{
+		l:    log.New("component", "service"),
+		opts: Options{Search: dutSearch(ctx, fake)},
+	}
+
+	for i, te := range []struct {
+		query string
+		want  string
+		// impossible is set if the query is expected to match no issues.
+		impossible bool
+	}{
+		{"baz", "[]", false},
+		{"foo bar", "[warning at 0-7: keywords match more than 1000 issues, only the most relevant ones are shown]", false},
+		{"-baz", "[]", false},
+		// Negated truncated keywords don't match any issues.
+		{"baz -(foo bar)", "[error at 6-13: cannot exclude keywords matching more than 1000 issues]", true},
+		{"baz OR -(foo bar)", "[error at 9-16: cannot exclude keywords matching more than 1000 issues]", false},
+		// Doubly negated keywords only include issues, like plain ones.
+		{"baz -(-(foo bar))", "[warning at 8-15: keywords match more than 1000 issues, only the most relevant ones are shown]", false},
+	} {
+		c := newQueryCompiler(ctx, s)
+		f, err := c.compile(search.ParseSearch(te.query).Expr)
+		if err != nil {
+			t.Fatalf("test %d: compile: %v", i, err)
+		}
+		if want, got := te.want, fmt.Sprintf("%v", c.errors); want != got {
+			t.Errorf("test %d: wanted errors %s, got %s", i, want, got)
+		}
+		if want, got := te.impossible, f == nil; want != got {
+			t.Errorf("test %d: wanted impossible %v, got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/pagination"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Live update streams (MODE_STATUS_AND_UPDATES_LIVE) need to learn about new
+// updates as soon as possible, regardless of which model replica committed
+// them.
+//
+// Updates committed by this replica are signalled through an in-process
+// issueNotifier, so streams get woken up immediately after the commit.
+// Updates committed by other replicas are picked up by periodically polling
+// the database for updates past the last one sent. As update IDs are
+// allocated densely and in commit order per issue, resuming from the last
+// sent ID never skips an update.
+//
+// CockroachDB changefeeds could replace the polling, but core changefeeds
+// require rangefeeds to be enabled cluster-wide and hold a connection per
+// stream, which is a steep price for a bug tracker.
+
+const (
+	// defaultLivePollInterval is used when Options.LivePollInterval is not
+	// set.
+	defaultLivePollInterval = 2 * time.Second
+	// liveChunkSize is the maximum amount of updates retrieved from the
+	// database (and sent to the client) at once in live streams.
+	liveChunkSize = 100
+)
+
+// anyIssue can be passed to issueNotifier.subscribe to get notified about
+// changes to all issues. Issue IDs are never zero.
+const anyIssue = 0
+
+// issueNotifier allows live streams to wait for changes to issues.
+type issueNotifier struct {
+	mu      sync.Mutex
+	waiters map[int64]map[chan struct{}]bool
+}
+
+// subscribe returns a channel that receives a value whenever the given issue
+// gets created or updated, and a function that must be called to
+// unsubscribe. Multiple notifications might get coalesced into one.
+func (n *issueNotifier) subscribe(id int64) (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.waiters == nil {
+		n.waiters = make(map[int64]map[chan struct{}]bool)
+	}
+	if n.waiters[id] == nil {
+		n.waiters[id] = make(map[chan struct{}]bool)
+	}
+	n.waiters[id][c] = true
+
+	return c, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.waiters[id], c)
+		if len(n.waiters[id]) == 0 {
+			delete(n.waiters, id)
+		}
+	}
+}
+
+// notify wakes up all subscribers of a given issue, and of all issues.
+func (n *issueNotifier) notify(id int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range []int64{id, anyIssue} {
+		for c := range n.waiters[key] {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (s *Service) getIssueUpdatesLive(req *spb.ModelGetIssueUpdatesRequest, srv spb.Model_GetIssueUpdatesServer) error {
+	ctx := srv.Context()
+
+	var start int64
+	if p := req.Pagination; p != nil {
+		t, err := pagination.DecodeToken(p.After)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid pagination 'after': %v", err)
+		}
+		if t != nil && t.Before {
+			return status.Error(codes.InvalidArgument, "live streams cannot be paginated backwards")
+		}
+		if start, err = updateTokenID(t); err != nil {
+			return err
+		}
+	}
+
+	// Subscribe before first reading history, so that no update committed in
+	// between gets missed.
+	wake, unsubscribe := s.updates.subscribe(req.Id)
+	defer unsubscribe()
+
+	if _, err := s.db.Do(ctx).Issue().Get(req.Id); err != nil {
+		return err
+	}
+
+	interval := s.opts.LivePollInterval
+	if interval == 0 {
+		interval = defaultLivePollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		opts := &db.IssueGetHistoryOpts{Start: start, Count: liveChunkSize}
+		updates, err := s.db.Do(ctx).Issue().GetHistory(req.Id, opts)
+		if err != nil {
+			return err
+		}
+		if len(updates) > 0 {
+			last := updates[len(updates)-1]
+			chunk := &spb.ModelGetIssueUpdatesChunk{
+				NextPageToken: updateToken(last).Encode(),
+			}
+			for _, u := range updates {
+				chunk.Updates = append(chunk.Updates, u.Proto())
+			}
+			if err := srv.Send(chunk); err != nil {
+				return err
+			}
+			start = last.UpdateID
+		}
+		// More history is immediately available, don't wait.
+		if len(updates) == liveChunkSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
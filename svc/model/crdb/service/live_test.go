@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+)
+
+func TestIssueNotifier(t *testing.T) {
+	n := issueNotifier{}
+
+	c1, unsub1 := n.subscribe(1)
+	c2, unsub2 := n.subscribe(2)
+	defer unsub2()
+
+	// Multiple notifications get coalesced, and only reach subscribers of
+	// the notified issue.
+	n.notify(1)
+	n.notify(1)
+	select {
+	case <-c1:
+	default:
+		t.Fatalf("subscriber of issue 1 not notified")
+	}
+	select {
+	case <-c1:
+		t.Fatalf("subscriber of issue 1 notified twice")
+	case <-c2:
+		t.Fatalf("subscriber of issue 2 notified")
+	default:
+	}
+
+	unsub1()
+	if _, ok := n.waiters[1]; ok {
+		t.Fatalf("issue 1 still has waiters after unsubscribe")
+	}
+	n.notify(1)
+}
+
+func TestIssueUpdatesLive(t *testing.T) {
+	ctx, ctxC := context.WithCancel(context.Background())
+	defer ctxC()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	res, err := model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+		Author: users["q3k"],
+		InitialState: &cpb.IssueState{
+			Title:    "test issue",
+			Type:     cpb.IssueType_BUG,
+			Priority: 2,
+			Status:   cpb.IssueStatus_NEW,
+		},
+		InitialComment: "comment 0",
+	})
+	if err != nil {
+		t.Fatalf("NewIssue: %v", err)
+	}
+
+	srv, err := model.GetIssueUpdates(ctx, &spb.ModelGetIssueUpdatesRequest{
+		Id:   res.Id,
+		Mode: spb.ModelGetIssueUpdatesRequest_MODE_STATUS_AND_UPDATES_LIVE,
+	})
+	if err != nil {
+		t.Fatalf("GetIssueUpdates: %v", err)
+	}
+
+	// Receive updates in the background, as the stream never ends.
+	comments := make(chan string)
+	go func() {
+		defer close(comments)
+		for {
+			chunk, err := srv.Recv()
+			if err != nil {
+				return
+			}
+			for _, u := range chunk.Updates {
+				comments <- u.Comment
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			_, err := model.UpdateIssue(ctx, &spb.ModelUpdateIssueRequest{
+				Id:      res.Id,
+				Author:  users["implr"],
+				Comment: fmt.Sprintf("comment %d", i),
+			})
+			if err != nil {
+				t.Fatalf("UpdateIssue: %v", err)
+			}
+		}
+
+		// Updates are expected way before the poll interval expires, as
+		// they were committed by the same replica.
+		select {
+		case got := <-comments:
+			if want := fmt.Sprintf("comment %d", i); want != got {
+				t.Fatalf("update %d: wanted comment %q, got %q", i, want, got)
+			}
+		case <-time.After(defaultLivePollInterval / 2):
+			t.Fatalf("update %d: not received", i)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/search"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// queryCompiler translates the expression tree of a search query into a
+// database filter, resolving usernames, categories and keywords on the way.
+type queryCompiler struct {
+	s   *Service
+	ctx context.Context
+	// now is the time relative to which relative dates are parsed.
+	now time.Time
+
+	// errors are problems found in the query.
+	errors []*search.Error
+	// terms is the amount of terms which were compiled into a filter.
+	terms int
+	// hits caches Search service results by search query.
+	hits map[string]*keywordHits
+	// negated is set if the expression being compiled is under an odd amount
+	// of negations.
+	negated bool
+	// refused is the amount of negated keywords which could not be compiled,
+	// as not all issues matching them are known.
+	refused int
+}
+
+func newQueryCompiler(ctx context.Context, s *Service) *queryCompiler {
+	return &queryCompiler{
+		s:    s,
+		ctx:  ctx,
+		now:  time.Now(),
+		hits: make(map[string]*keywordHits),
+	}
+}
+
+// errorf records an error about a part of the query.
+func (c *queryCompiler) errorf(span search.Span, format string, args ...interface{}) {
+	c.errors = append(c.errors, &search.Error{
+		Severity: search.SeverityError,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// warnf records a problem about a part of the query that has been worked
+// around.
+func (c *queryCompiler) warnf(span search.Span, format string, args ...interface{}) {
+	c.errors = append(c.errors, &search.Error{
+		Severity: search.SeverityWarning,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// queryErrorsProto converts query errors into their protobuf representation.
+func queryErrorsProto(errors []*search.Error) []*spb.QueryError {
+	res := make([]*spb.QueryError, len(errors))
+	for i, e := range errors {
+		severity := spb.QueryError_SEVERITY_WARNING
+		if e.Severity == search.SeverityError {
+			severity = spb.QueryError_SEVERITY_ERROR
+		}
+		res[i] = &spb.QueryError{
+			Severity: severity,
+			Message:  e.Message,
+			Start:    int64(e.Span.Start),
+			End:      int64(e.Span.End),
+		}
+	}
+	return res
+}
+
+// keywords returns the issues matching all the given keywords.
+func (c *queryCompiler) keywords(keywords []string) (*keywordHits, error) {
+	if c.s.opts.Search == nil {
+		return nil, status.Error(codes.Unimplemented, "keyword search unavailable, use query filters")
+	}
+	q := searchQuery(keywords)
+	if hits, ok := c.hits[q]; ok {
+		return hits, nil
+	}
+	hits, err := c.s.searchKeywords(c.ctx, keywords)
+	if err != nil {
+		return nil, err
+	}
+	c.hits[q] = hits
+	return hits, nil
+}
+
+// compile returns a filter passing the issues matched by an expression, or
+// nil if the expression is known not to match any issue (ie. a filter
+// requested a datum that is known not to exist, like a user that could not be
+// resolved).
+func (c *queryCompiler) compile(e *search.Expr) (*db.IssueFilter, error) {
+	switch e.Op {
+	case search.OpTerm:
+		if e.Term.Key == "" {
+			return c.compileKeywords([]string{e.Term.Value}, e.Term.ValueSpan)
+		}
+		return c.compileConstraint(e.Term)
+
+	case search.OpAnd:
+		res := &db.IssueFilter{}
+		// All keywords of a conjunction are resolved with a single Search
+		// query.
+		var keywords []string
+		var span search.Span
+		// All operands are compiled even if the conjunction is known to be
+		// impossible, so that problems in all of them are reported.
+		impossible := false
+		for _, o := range e.Operands {
+			if o.Op == search.OpTerm && o.Term.Key == "" {
+				if len(keywords) == 0 {
+					span.Start = o.Term.ValueSpan.Start
+				}
+				span.End = o.Term.ValueSpan.End
+				keywords = append(keywords, o.Term.Value)
+				continue
+			}
+			f, err := c.compile(o)
+			if err != nil {
+				return nil, err
+			}
+			if f == nil {
+				impossible = true
+				continue
+			}
+			res.And = append(res.And, *f)
+		}
+		if impossible {
+			return nil, nil
+		}
+		if len(keywords) > 0 {
+			f, err := c.compileKeywords(keywords, span)
+			if err != nil {
+				return nil, err
+			}
+			if f == nil {
+				return nil, nil
+			}
+			res.And = append(res.And, *f)
+		}
+		return res, nil
+
+	case search.OpOr:
+		res := &db.IssueFilter{}
+		for _, o := range e.Operands {
+			f, err := c.compile(o)
+			if err != nil {
+				return nil, err
+			}
+			if f == nil {
+				continue
+			}
+			res.Or = append(res.Or, *f)
+		}
+		if len(res.Or) == 0 {
+			return nil, nil
+		}
+		return res, nil
+
+	case search.OpNot:
+		refused := c.refused
+		c.negated = !c.negated
+		f, err := c.compile(e.Operands[0])
+		c.negated = !c.negated
+		if err != nil {
+			return nil, err
+		}
+		// The negation of an incomplete set of issues would match issues
+		// that should be excluded, so no issues are matched instead.
+		if c.refused > refused {
+			return nil, nil
+		}
+		if f == nil {
+			return &db.IssueFilter{}, nil
+		}
+		return &db.IssueFilter{Not: f}, nil
+	}
+	return nil, status.Errorf(codes.Internal, "invalid query expression %v", e)
+}
+
+// compileKeywords returns a filter passing the issues matching all the given
+// keywords, which are found in a given span of the query.
+func (c *queryCompiler) compileKeywords(keywords []string, span search.Span) (*db.IssueFilter, error) {
+	c.terms++
+	hits, err := c.keywords(keywords)
+	if err != nil {
+		return nil, err
+	}
+	if hits.truncated {
+		if c.negated {
+			c.errorf(span, "cannot exclude keywords matching more than %d issues", maxKeywordHits)
+			c.refused++
+			return nil, nil
+		}
+		c.warnf(span, "keywords match more than %d issues, only the most relevant ones are shown", maxKeywordHits)
+	}
+	if len(hits.ids) == 0 {
+		return nil, nil
+	}
+	return &db.IssueFilter{IDs: hits.ids}, nil
+}
+
+// resolveUsername resolves a username in a query, or returns an empty string
+// if the user does not exist.
+func (c *queryCompiler) resolveUsername(field, username string, span search.Span) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	// TODO(q3k): cache these lookups
+	id, err := c.s.db.Do(c.ctx).User().ResolveUsername(username)
+	if err != nil {
+		if err == db.UserErrorNoSuchUsername {
+			c.errorf(span, "unknown %s %q", field, username)
+			return "", nil
+		}
+		c.s.l.Error("ResolveUser failed", "username", username, "err", err)
+		return "", status.Error(codes.Unavailable, "could not resolve user")
+	}
+	return id, nil
+}
+
+// knownFields are the names of all fields that can be used in key/value
+// filters (with aliases resolved).
+var knownFields = func() map[string]bool {
+	res := make(map[string]bool)
+	for _, f := range search.Fields {
+		res[f] = true
+	}
+	return res
+}()
+
+// sortFields maps field names in sort directives to request orderings.
+var sortFields = map[string]spb.ModelGetIssuesRequest_OrderBy{
+	"created":   spb.ModelGetIssuesRequest_ORDER_BY_CREATED,
+	"updated":   spb.ModelGetIssuesRequest_ORDER_BY_LAST_UPDATE,
+	"relevance": spb.ModelGetIssuesRequest_ORDER_BY_RELEVANCE,
+	"priority":  spb.ModelGetIssuesRequest_ORDER_BY_PRIORITY,
+	"status":    spb.ModelGetIssuesRequest_ORDER_BY_STATUS,
+	"type":      spb.ModelGetIssuesRequest_ORDER_BY_TYPE,
+	"assignee":  spb.ModelGetIssuesRequest_ORDER_BY_ASSIGNEE,
+	"title":     spb.ModelGetIssuesRequest_ORDER_BY_TITLE,
+}
+
+// ordering returns the ordering requested for a query: the one given by its
+// sort directives if any, otherwise the one given by the request. Unknown
+// fields in sort directives are reported and ignored.
+func (c *queryCompiler) ordering(req *spb.ModelGetIssuesRequest, q *search.Query) []*spb.ModelGetIssuesRequest_Sort {
+	var res []*spb.ModelGetIssuesRequest_Sort
+	for _, k := range q.Sort {
+		by, ok := sortFields[k.Field]
+		if !ok {
+			c.errorf(k.Span, "unknown sort field %q", k.Field)
+			continue
+		}
+		res = append(res, &spb.ModelGetIssuesRequest_Sort{By: by, Descending: k.Descending})
+	}
+	if len(res) > 0 {
+		return res
+	}
+	if len(req.Sort) > 0 {
+		return req.Sort
+	}
+	return []*spb.ModelGetIssuesRequest_Sort{{By: req.OrderBy}}
+}
+
+// compileRange compiles a comparison or range filter on an ordered field into a
+// range of field values, given a function that parses a value into the range
+// of field values [from, to) it describes. If the filter is invalid, an error
+// is recorded and ok is false.
+func (c *queryCompiler) compileRange(t *search.Term, parse func(string) (from, to int64, ok bool)) (r db.IssueRange, ok bool) {
+	bound := func(comparison search.Comparison, value string) bool {
+		from, to, ok := parse(value)
+		if !ok {
+			c.errorf(t.ValueSpan, "invalid %s %q", t.Key, value)
+			return false
+		}
+		switch comparison {
+		case search.ComparisonEqual:
+			r.Min = sql.NullInt64{Int64: from, Valid: true}
+			r.Max = sql.NullInt64{Int64: to, Valid: true}
+		case search.ComparisonLess:
+			r.Max = sql.NullInt64{Int64: from, Valid: true}
+		case search.ComparisonLessEqual:
+			r.Max = sql.NullInt64{Int64: to, Valid: true}
+		case search.ComparisonGreater:
+			r.Min = sql.NullInt64{Int64: to, Valid: true}
+		case search.ComparisonGreaterEqual:
+			r.Min = sql.NullInt64{Int64: from, Valid: true}
+		}
+		return true
+	}
+
+	from, to, isRange := t.Range()
+	if !isRange {
+		return r, bound(t.Comparison, t.Value)
+	}
+	if from == "" && to == "" {
+		c.errorf(t.ValueSpan, "invalid %s range %q", t.Key, t.Value)
+		return r, false
+	}
+	if from != "" && !bound(search.ComparisonGreaterEqual, from) {
+		return r, false
+	}
+	if to != "" && !bound(search.ComparisonLessEqual, to) {
+		return r, false
+	}
+	return r, true
+}
+
+// parsePriority parses a priority in a query (like 2 or P2) into the range of
+// priorities it describes.
+func parsePriority(s string) (int64, int64, bool) {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "p")
+	p, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return p, p + 1, true
+}
+
+// parseDate parses a date in a query into the range of timestamps it
+// describes.
+func (c *queryCompiler) parseDate(s string) (int64, int64, bool) {
+	start, end, ok := search.ParseDate(s, c.now)
+	if !ok {
+		return 0, 0, false
+	}
+	return start.UnixNano(), end.UnixNano(), true
+}
+
+func (c *queryCompiler) compileConstraint(t *search.Term) (*db.IssueFilter, error) {
+	if !knownFields[t.Key] {
+		c.terms++
+		c.errorf(t.KeySpan, "unknown field %q", t.Key)
+		return nil, nil
+	}
+
+	switch t.Key {
+	case "priority", "created", "updated":
+		return c.compileRanges(t), nil
+	case "title":
+		c.terms++
+		if t.Comparison != search.ComparisonEqual {
+			c.errorf(search.Span{Start: t.KeySpan.Start, End: t.ValueSpan.End}, "%s cannot be compared with %s", t.Key, t.Comparison)
+			return nil, nil
+		}
+		// Titles are free text, and can contain commas.
+		title := strings.TrimSpace(t.Value)
+		if title == "" {
+			c.errorf(t.ValueSpan, "%s must have a value", t.Key)
+			return nil, nil
+		}
+		return &db.IssueFilter{Title: title}, nil
+	}
+
+	// All other fields only support equality, and lists of values.
+	c.terms++
+	if t.Comparison != search.ComparisonEqual {
+		c.errorf(search.Span{Start: t.KeySpan.Start, End: t.ValueSpan.End}, "%s cannot be compared with %s", t.Key, t.Comparison)
+		return nil, nil
+	}
+	values := t.Values()
+	if len(values) == 0 {
+		c.errorf(t.ValueSpan, "%s must have a value", t.Key)
+		return nil, nil
+	}
+
+	// Invalid values are reported and skipped. If no valid values are left,
+	// the filter cannot pass.
+	res := &db.IssueFilter{}
+	valid := 0
+	for _, v := range values {
+		ok, err := c.compileValue(t, v, res)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			valid++
+		}
+	}
+	if valid == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// compileValue adds a single value of an equality filter to a filter. If the
+// value is invalid, an error is recorded and false is returned.
+func (c *queryCompiler) compileValue(t *search.Term, v string, f *db.IssueFilter) (bool, error) {
+	key := t.Key
+	invalid := func(format string) (bool, error) {
+		c.errorf(t.ValueSpan, format, key, v)
+		return false, nil
+	}
+
+	switch key {
+	case "id":
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return invalid("invalid %s %q")
+		}
+		f.IDs = append(f.IDs, id)
+
+	case "author", "assignee", "cc", "commenter":
+		id, err := c.resolveUsername(key, v, t.ValueSpan)
+		if err != nil || id == "" {
+			return false, err
+		}
+		switch key {
+		case "author":
+			f.Authors = append(f.Authors, id)
+		case "assignee":
+			f.Assignees = append(f.Assignees, id)
+		case "cc":
+			f.CCs = append(f.CCs, id)
+		default:
+			f.Commenters = append(f.Commenters, id)
+		}
+
+	case "status":
+		st := search.ParseIssueStatus(v)
+		if st == 0 {
+			return invalid("unknown %s %q")
+		}
+		f.Statuses = append(f.Statuses, int64(st))
+
+	case "is":
+		group := search.ParseIssueStatusGroup(v)
+		if group == nil {
+			return invalid("unknown %s:%s, only is:open and is:closed are supported")
+		}
+		for _, st := range group {
+			f.Statuses = append(f.Statuses, int64(st))
+		}
+
+	case "type":
+		typ := search.ParseIssueType(v)
+		if typ == 0 {
+			return invalid("unknown %s %q")
+		}
+		f.Types = append(f.Types, int64(typ))
+
+	case "has":
+		if strings.ToLower(v) != "assignee" {
+			return invalid("unknown %s:%s, only has:assignee is supported")
+		}
+		f.Assigned = true
+
+	case "category":
+		// Categories match the given category and all its descendants.
+		category := strings.Trim(v, "/")
+		cat, err := c.s.db.Do(c.ctx).Category().ResolvePath(strings.Split(category, "/"))
+		if err != nil {
+			if err == db.CategoryErrorNotFound {
+				return invalid("unknown %s %q")
+			}
+			c.s.l.Error("ResolvePath failed", "category", category, "err", err)
+			return false, status.Error(codes.Unavailable, "could not resolve category")
+		}
+		tree, err := c.s.db.Do(c.ctx).Category().GetTree(cat.UUID, db.CategoryTreeAllLevels)
+		if err != nil {
+			c.s.l.Error("GetTree failed", "category", cat.UUID, "err", err)
+			return false, status.Error(codes.Unavailable, "could not retrieve category tree")
+		}
+		f.Categories = append(f.Categories, tree.UUIDs()...)
+
+	default:
+		return false, status.Errorf(codes.Internal, "unhandled field %q", key)
+	}
+	return true, nil
+}
+
+// compileRanges compiles a filter on an ordered field, which can be a list of
+// values, ranges or comparisons. Any of these matching passes the filter.
+func (c *queryCompiler) compileRanges(t *search.Term) *db.IssueFilter {
+	c.terms++
+	parse := c.parseDate
+	if t.Key == "priority" {
+		parse = parsePriority
+	}
+
+	values := t.Values()
+	if len(values) == 0 {
+		c.errorf(t.ValueSpan, "%s must have a value", t.Key)
+		return nil
+	}
+
+	res := &db.IssueFilter{}
+	for _, v := range values {
+		r, ok := c.compileRange(&search.Term{Key: t.Key, Comparison: t.Comparison, Value: v, ValueSpan: t.ValueSpan}, parse)
+		if !ok {
+			continue
+		}
+		f := db.IssueFilter{}
+		switch t.Key {
+		case "priority":
+			f.Priority = r
+		case "created":
+			f.Created = r
+		default:
+			f.Updated = r
+		}
+		res.Or = append(res.Or, f)
+	}
+	switch len(res.Or) {
+	case 0:
+		return nil
+	case 1:
+		return &res.Or[0]
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/q3k/bugless/svc/model/common/search"
+)
+
+func TestCompileTitle(t *testing.T) {
+	for i, te := range []struct {
+		query  string
+		title  string
+		errors string
+	}{
+		{"title:startup", "startup", "[]"},
+		{`title:"crash, then hang"`, "crash, then hang", "[]"},
+		{"title>startup", "", "[error at 0-13: title cannot be compared with >]"},
+		{`title:""`, "", "[error at 6-8: title must have a value]"},
+		{`title:"  "`, "", "[error at 6-10: title must have a value]"},
+	} {
+		c := newQueryCompiler(context.Background(), &Service{})
+		f, err := c.compile(search.ParseSearch(te.query).Expr)
+		if err != nil {
+			t.Fatalf("test %d: compile: %v", i, err)
+		}
+		title := ""
+		if f != nil {
+			title = f.Title
+		}
+		if want, got := te.title, title; want != got {
+			t.Errorf("test %d: wanted title filter %q, got %q", i, want, got)
+		}
+		if want, got := te.errors, fmt.Sprintf("%v", c.errors); want != got {
+			t.Errorf("test %d: wanted errors %s, got %s", i, want, got)
+		}
+	}
+}
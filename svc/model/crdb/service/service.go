@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	spb "github.com/q3k/bugless/proto/svc"
 	"github.com/q3k/bugless/svc/model/crdb/db"
 
 	"github.com/cockroachdb/cockroach-go/testserver"
@@ -12,11 +14,31 @@ import (
 )
 
 type Service struct {
-	db db.Database
-	l  log.Logger
+	db   db.Database
+	l    log.Logger
+	opts Options
+
+	// updates notifies live update streams about issue updates committed by
+	// this replica.
+	updates issueNotifier
+}
+
+// Options configure optional behaviour of the Service.
+type Options struct {
+	// AutoProvisionUsers makes the Service create users that author a
+	// request by username, but do not yet exist. This is meant for
+	// deployments where users are managed by an external IdP, and should be
+	// created on their first authenticated request.
+	AutoProvisionUsers bool
+	// LivePollInterval is how often live update streams poll the database
+	// for updates committed by other replicas. If zero, a default is used.
+	LivePollInterval time.Duration
+	// Search is the Search service used for keyword search of issues. If
+	// nil, queries containing keywords are rejected.
+	Search spb.SearchClient
 }
 
-func NewDSN(ctx context.Context, dsn string, migrate bool, l log.Logger) (*Service, error) {
+func NewDSN(ctx context.Context, dsn string, migrate bool, opts Options, l log.Logger) (*Service, error) {
 	if dsn == "" {
 		return nil, fmt.Errorf("dsn must be set")
 	}
@@ -36,12 +58,13 @@ func NewDSN(ctx context.Context, dsn string, migrate bool, l log.Logger) (*Servi
 	}
 
 	return &Service{
-		db: d,
-		l:  l.New("component", "service"),
+		db:   d,
+		l:    l.New("component", "service"),
+		opts: opts,
 	}, nil
 }
 
-func NewInMemory(ctx context.Context, l log.Logger) (*Service, error) {
+func NewInMemory(ctx context.Context, opts Options, l log.Logger) (*Service, error) {
 	d, err := inMemoryDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not create in-memory database: %v", err)
@@ -50,8 +73,9 @@ func NewInMemory(ctx context.Context, l log.Logger) (*Service, error) {
 		return nil, fmt.Errorf("could not migrate database: %v", err)
 	}
 	return &Service{
-		db: d,
-		l:  l.New("component", "service"),
+		db:   d,
+		l:    l.New("component", "service"),
+		opts: opts,
 	}, nil
 }
 
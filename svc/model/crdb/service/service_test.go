@@ -15,6 +15,10 @@ import (
 )
 
 func dutModel() (spb.ModelClient, map[string]*cpb.User, context.CancelFunc) {
+	return dutModelWithOptions(Options{})
+}
+
+func dutModelWithOptions(opts Options) (spb.ModelClient, map[string]*cpb.User, context.CancelFunc) {
 	ctx, ctxC := context.WithCancel(context.Background())
 
 	lis := bufconn.Listen(1024 * 1024)
@@ -28,8 +32,9 @@ func dutModel() (spb.ModelClient, map[string]*cpb.User, context.CancelFunc) {
 		panic(err)
 	}
 	spb.RegisterModelServer(s, &Service{
-		db: d,
-		l:  log.New("component", "service"),
+		db:   d,
+		l:    log.New("component", "service"),
+		opts: opts,
 	})
 
 	go func() {
@@ -70,3 +75,33 @@ func dutModel() (spb.ModelClient, map[string]*cpb.User, context.CancelFunc) {
 
 	return client, users, ctxC
 }
+
+// dutSearch returns a client connected to the given Search service
+// implementation, served until ctx is canceled.
+func dutSearch(ctx context.Context, search spb.SearchServer) spb.SearchClient {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	spb.RegisterSearchServer(s, search)
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			panic(err)
+		}
+	}()
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}), grpc.WithInsecure())
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+		s.Stop()
+	}()
+
+	return spb.NewSearchClient(conn)
+}
@@ -14,31 +14,87 @@ import (
 )
 
 func (s *Service) GetIssueUpdates(req *spb.ModelGetIssueUpdatesRequest, srv spb.Model_GetIssueUpdatesServer) error {
+	switch req.Mode {
+	case spb.ModelGetIssueUpdatesRequest_MODE_INVALID, spb.ModelGetIssueUpdatesRequest_MODE_STATUS_AND_UPDATES:
+	case spb.ModelGetIssueUpdatesRequest_MODE_STATUS_AND_UPDATES_LIVE:
+		return s.getIssueUpdatesLive(req, srv)
+	default:
+		return status.Errorf(codes.InvalidArgument, "invalid mode (%s)", req.Mode.String())
+	}
+
 	ctx := srv.Context()
 
 	// TODO(q3k): define the consistency guarantees for this call.
 	session := s.db.Begin(ctx)
 	defer session.Rollback()
 
-	return pagination.ResampleInt64(req.Pagination, func(first bool, start pagination.V, count int64) (int, pagination.V, error) {
-		opts := &db.IssueGetHistoryOpts{Start: start.(int64), Count: count}
+	locate := func(before *pagination.Token, n int64) (*pagination.Token, error) {
+		id, err := updateTokenID(before)
+		if err != nil {
+			return nil, err
+		}
+		opts := &db.IssueGetHistoryOpts{Start: id, Count: n, Reverse: true}
+		updates, err := session.Issue().GetHistory(req.Id, opts)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(updates)) < n {
+			return nil, nil
+		}
+		return updateToken(updates[n-1]), nil
+	}
+
+	return pagination.ResampleToken(req.Pagination, locate, func(first bool, start pagination.V, count int64) (int, pagination.V, error) {
+		after, err := updateTokenID(start.(*pagination.Token))
+		if err != nil {
+			return 0, start, err
+		}
+		opts := &db.IssueGetHistoryOpts{Start: after, Count: count}
 		updates, err := session.Issue().GetHistory(req.Id, opts)
 		if err != nil {
 			return 0, start, err
 		}
 
 		chunk := &spb.ModelGetIssueUpdatesChunk{}
+		if first {
+			var firstUpdate *pagination.Token
+			if len(updates) > 0 {
+				firstUpdate = updateToken(updates[0])
+			}
+			chunk.PrevPageToken = pagination.PrevPageToken(start.(*pagination.Token), firstUpdate)
+		}
 		for _, u := range updates {
 			chunk.Updates = append(chunk.Updates, u.Proto())
 		}
 
 		if len(updates) > 0 {
-			start = updates[len(updates)-1].UpdateID
+			start = updateToken(updates[len(updates)-1])
+		}
+		if int64(len(updates)) == count {
+			chunk.NextPageToken = start.(*pagination.Token).Encode()
 		}
 		return len(updates), start, srv.Send(chunk)
 	})
 }
 
+// updateToken returns the page token of an issue update. Updates are ordered
+// by their ID, which is unique within an issue.
+func updateToken(u *db.IssueUpdate) *pagination.Token {
+	return &pagination.Token{ID: u.UpdateID}
+}
+
+// updateTokenID returns the ID of the update from a page token, or zero if the
+// token is nil.
+func updateTokenID(t *pagination.Token) (int64, error) {
+	if t == nil {
+		return 0, nil
+	}
+	if len(t.Key) != 0 {
+		return 0, status.Error(codes.InvalidArgument, "invalid pagination 'after': not an update token")
+	}
+	return t.ID, nil
+}
+
 func (s *Service) UpdateIssue(ctx context.Context, req *spb.ModelUpdateIssueRequest) (*spb.ModelUpdateIssueResponse, error) {
 	if err := validation.User(req.Author); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "author: %v", err)
@@ -47,10 +103,40 @@ func (s *Service) UpdateIssue(ctx context.Context, req *spb.ModelUpdateIssueRequ
 		return nil, status.Error(codes.InvalidArgument, "diff must be set")
 	}
 	diff := req.Diff
+	if diff.Assignee != nil && diff.Assignee.Value != nil {
+		if err := validation.User(diff.Assignee.Value); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "assignee: %v", err)
+		}
+	}
+	if diff.Category != nil {
+		if err := validation.Category(diff.Category); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "category: %v", err)
+		}
+	}
+	for i, u := range diff.CcAdded {
+		if err := validation.User(u); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "cc_added[%d]: %v", i, err)
+		}
+	}
+	for i, u := range diff.CcRemoved {
+		if err := validation.User(u); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "cc_removed[%d]: %v", i, err)
+		}
+	}
 
 	session := s.db.Begin(ctx)
 	defer session.Rollback()
 
+	users := []*cpb.User{}
+	if diff.Assignee != nil {
+		users = append(users, diff.Assignee.Value)
+	}
+	users = append(users, diff.CcAdded...)
+	users = append(users, diff.CcRemoved...)
+	if err := s.resolveRequestUsers(session, req.Author, users...); err != nil {
+		return nil, err
+	}
+
 	// This is somewhat ugly - but in order to check some of the update logic,
 	// we need to actually retrieve the current state of the issue.
 	issue, err := session.Issue().Get(req.Id)
@@ -59,10 +145,16 @@ func (s *Service) UpdateIssue(ctx context.Context, req *spb.ModelUpdateIssueRequ
 	}
 
 	applyUpdateLogic(issue.Proto().Current, diff)
+	ccAdded, ccRemoved, err := ccChanges(issue.CCIDs, diff)
+	if err != nil {
+		return nil, err
+	}
 
 	update := &db.IssueUpdate{
-		IssueID:  req.Id,
-		AuthorID: req.Author.Id,
+		IssueID:      req.Id,
+		AuthorID:     req.Author.Id,
+		CCAddedIDs:   ccAdded,
+		CCRemovedIDs: ccRemoved,
 	}
 	if req.Comment != "" {
 		update.Comment.Valid = true
@@ -90,12 +182,48 @@ func (s *Service) UpdateIssue(ctx context.Context, req *spb.ModelUpdateIssueRequ
 		update.Status.Valid = true
 		update.Status.Int64 = int64(diff.Status)
 	}
+	if diff.Category != nil {
+		update.CategoryID.Valid = true
+		update.CategoryID.String = diff.Category.Id
+	}
 
 	err = session.Issue().Update(update)
 	if err != nil {
 		return nil, err
 	}
-	return &spb.ModelUpdateIssueResponse{}, session.Commit()
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	s.updates.notify(req.Id)
+	return &spb.ModelUpdateIssueResponse{}, nil
+}
+
+// ccChanges returns the IDs of users to be added to and removed from a CC
+// list, given the current CC list and a diff with resolved users. Changes that
+// would be no-ops are dropped.
+func ccChanges(cur []string, d *cpb.IssueStateDiff) (added, removed []string, err error) {
+	onList := make(map[string]bool)
+	for _, id := range cur {
+		onList[id] = true
+	}
+	adding := make(map[string]bool)
+	for _, u := range d.CcAdded {
+		if !adding[u.Id] && !onList[u.Id] {
+			added = append(added, u.Id)
+		}
+		adding[u.Id] = true
+	}
+	removing := make(map[string]bool)
+	for _, u := range d.CcRemoved {
+		if adding[u.Id] {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "user %q cannot be both added to and removed from cc list", u.Username)
+		}
+		if !removing[u.Id] && onList[u.Id] {
+			removed = append(removed, u.Id)
+		}
+		removing[u.Id] = true
+	}
+	return added, removed, nil
 }
 
 // applyUpdateLogic is a hairly ball of logic to ensure that issue states
@@ -132,6 +260,9 @@ func applyUpdateLogic(cur *cpb.IssueState, d *cpb.IssueStateDiff) {
 	if validation.IssueStatus(d.Status) == nil {
 		new.Status = d.Status
 	}
+	if d.Category != nil {
+		new.Category = d.Category
+	}
 
 	if new.Status == cpb.IssueStatus_NEW && new.Assignee != nil {
 		// Problem: an issue cannot be NEW and have someone assigned.
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+	"github.com/q3k/bugless/svc/model/common/validation"
+	"github.com/q3k/bugless/svc/model/crdb/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxUsersPerRequest is the maximum amount of users (by ID and username) that
+// can be requested in a single GetUsers call.
+const maxUsersPerRequest = 128
+
+// nullString returns a NullString that is NULL when s is empty.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (s *Service) NewUser(ctx context.Context, req *spb.ModelNewUserRequest) (*spb.ModelNewUserResponse, error) {
+	username := req.Username
+	if err := validation.Username(&username); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "username: %v", err)
+	}
+
+	user, err := s.db.Do(ctx).User().New(&db.User{
+		Username:    username,
+		Email:       nullString(req.Email),
+		DisplayName: nullString(req.DisplayName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &spb.ModelNewUserResponse{
+		User: user.Proto(),
+	}, nil
+}
+
+func (s *Service) GetUsers(ctx context.Context, req *spb.ModelGetUsersRequest) (*spb.ModelGetUsersResponse, error) {
+	if len(req.Ids)+len(req.Usernames) > maxUsersPerRequest {
+		return nil, status.Errorf(codes.InvalidArgument, "can request at most %d users", maxUsersPerRequest)
+	}
+
+	session := s.db.Begin(ctx)
+	defer session.Rollback()
+
+	// Invalid IDs and usernames cannot belong to any user, so they are
+	// skipped like those of nonexistent users.
+	var ids, usernames []string
+	for _, id := range req.Ids {
+		if err := validation.UserID(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	for _, username := range req.Usernames {
+		if err := validation.Username(&username); err == nil {
+			usernames = append(usernames, username)
+		}
+	}
+
+	byID, err := session.User().GetMany(ids)
+	if err != nil {
+		return nil, err
+	}
+	byUsername, err := session.User().GetManyByUsername(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deduplicate users requested both by ID and username.
+	seen := make(map[string]bool)
+	res := &spb.ModelGetUsersResponse{}
+	for _, u := range append(byID, byUsername...) {
+		if seen[u.ID] || u.ID == db.UnassignedUUID {
+			continue
+		}
+		seen[u.ID] = true
+		res.Users = append(res.Users, u.ProfileProto())
+	}
+	return res, session.Commit()
+}
+
+func (s *Service) UpdateUser(ctx context.Context, req *spb.ModelUpdateUserRequest) (*spb.ModelUpdateUserResponse, error) {
+	if err := validation.User(req.User); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user: %v", err)
+	}
+
+	session := s.db.Begin(ctx)
+	defer session.Rollback()
+
+	if err := resolveUser(session, req.User, false); err != nil {
+		return nil, err
+	}
+	if req.User.Id == db.UnassignedUUID {
+		return nil, status.Error(codes.InvalidArgument, "cannot update unassigned user")
+	}
+
+	user, err := session.User().Get(req.User.Id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Email != nil {
+		user.Email = nullString(req.Email.Value)
+	}
+	if req.DisplayName != nil {
+		user.DisplayName = nullString(req.DisplayName.Value)
+	}
+
+	if err := session.User().Update(user); err != nil {
+		return nil, err
+	}
+	return &spb.ModelUpdateUserResponse{}, session.Commit()
+}
+
+// resolveUser fills in the ID of a user referenced by a request (see
+// common.User), resolving its username if necessary, and ensures that the
+// user exists. If provision is set, users referenced by an unknown username
+// are created.
+func resolveUser(session db.Session, u *cpb.User, provision bool) error {
+	if u.Id != "" {
+		user, err := session.User().Get(u.Id)
+		if err != nil {
+			return err
+		}
+		u.Username = user.Username
+		return nil
+	}
+
+	id, err := session.User().ResolveUsername(u.Username)
+	if err == nil {
+		u.Id = id
+		return nil
+	}
+	if !provision || status.Code(err) != codes.NotFound {
+		return err
+	}
+	user, err := session.User().New(&db.User{
+		Username: u.Username,
+	})
+	if err != nil {
+		return err
+	}
+	u.Id = user.ID
+	return nil
+}
+
+// resolveRequestUsers resolves the author and all other users referenced by a
+// request that creates or modifies data. Only the author is auto-provisioned
+// (if enabled), as this is the user that authenticated the request. Unknown
+// users are reported as invalid arguments.
+func (s *Service) resolveRequestUsers(session db.Session, author *cpb.User, others ...*cpb.User) error {
+	if err := resolveUser(session, author, s.opts.AutoProvisionUsers); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return status.Errorf(codes.InvalidArgument, "author: %v", status.Convert(err).Message())
+		}
+		return err
+	}
+	for _, u := range others {
+		if u == nil {
+			continue
+		}
+		if err := resolveUser(session, u, false); err != nil {
+			if status.Code(err) == codes.NotFound {
+				name := u.Id
+				if name == "" {
+					name = u.Username
+				}
+				return status.Errorf(codes.InvalidArgument, "user %q: %v", name, status.Convert(err).Message())
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	spb "github.com/q3k/bugless/proto/svc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+
+	model, users, cancel := dutModel()
+	defer cancel()
+
+	// Usernames are normalized and validated.
+	res, err := model.NewUser(ctx, &spb.ModelNewUserRequest{
+		Username:    " Informatic ",
+		DisplayName: "Piotr",
+	})
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+	informatic := res.User
+	if want, got := "informatic", informatic.Username; want != got {
+		t.Fatalf("new user has username %q, wanted %q", got, want)
+	}
+	_, err = model.NewUser(ctx, &spb.ModelNewUserRequest{Username: "in formatic"})
+	if want, got := codes.InvalidArgument, status.Code(err); want != got {
+		t.Fatalf("NewUser(invalid): wanted %v, got %v", want, got)
+	}
+	_, err = model.NewUser(ctx, &spb.ModelNewUserRequest{Username: "informatic"})
+	if want, got := codes.AlreadyExists, status.Code(err); want != got {
+		t.Fatalf("NewUser(duplicate): wanted %v, got %v", want, got)
+	}
+
+	// Update informatic by username, q3k by ID.
+	_, err = model.UpdateUser(ctx, &spb.ModelUpdateUserRequest{
+		User:  &cpb.User{Username: "informatic"},
+		Email: &spb.ModelUpdateUserRequest_MaybeString{Value: "informatic@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser(informatic): %v", err)
+	}
+	_, err = model.UpdateUser(ctx, &spb.ModelUpdateUserRequest{
+		User:        users["q3k"],
+		DisplayName: &spb.ModelUpdateUserRequest_MaybeString{Value: "Serge"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser(q3k): %v", err)
+	}
+	_, err = model.UpdateUser(ctx, &spb.ModelUpdateUserRequest{
+		User:  &cpb.User{Username: "nonexistent"},
+		Email: &spb.ModelUpdateUserRequest_MaybeString{Value: "foo@example.com"},
+	})
+	if want, got := codes.NotFound, status.Code(err); want != got {
+		t.Fatalf("UpdateUser(nonexistent): wanted %v, got %v", want, got)
+	}
+
+	// Retrieve users in a batch, with a duplicate and a nonexistent user.
+	// Invalid IDs and usernames are skipped, and usernames are normalized.
+	got, err := model.GetUsers(ctx, &spb.ModelGetUsersRequest{
+		Ids:       []string{informatic.Id, users["q3k"].Id, "not-a-uuid"},
+		Usernames: []string{" Informatic ", "nonexistent", "not a username"},
+	})
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	profiles := make(map[string]*cpb.UserProfile)
+	for _, p := range got.Users {
+		profiles[p.User.Username] = p
+	}
+	if want, got := 2, len(got.Users); want != got {
+		t.Fatalf("GetUsers returned %d users, wanted %d", got, want)
+	}
+	if want, got := "informatic@example.com", profiles["informatic"].Email; want != got {
+		t.Errorf("informatic has email %q, wanted %q", got, want)
+	}
+	if want, got := "Piotr", profiles["informatic"].DisplayName; want != got {
+		t.Errorf("informatic has display name %q, wanted %q", got, want)
+	}
+	if want, got := "Serge", profiles["q3k"].DisplayName; want != got {
+		t.Errorf("q3k has display name %q, wanted %q", got, want)
+	}
+}
+
+func TestIssueUserResolution(t *testing.T) {
+	ctx := context.Background()
+
+	newIssue := func(model spb.ModelClient, author, assignee *cpb.User) (*spb.ModelNewIssueResponse, error) {
+		return model.NewIssue(ctx, &spb.ModelNewIssueRequest{
+			Author: author,
+			InitialState: &cpb.IssueState{
+				Title:    "test issue",
+				Assignee: assignee,
+				Type:     cpb.IssueType_BUG,
+				Priority: 2,
+				Status:   cpb.IssueStatus_ASSIGNED,
+			},
+		})
+	}
+
+	t.Run("resolve", func(t *testing.T) {
+		model, users, cancel := dutModel()
+		defer cancel()
+
+		// Users can be referred to by username only.
+		res, err := newIssue(model, &cpb.User{Username: "Q3K"}, &cpb.User{Username: "implr"})
+		if err != nil {
+			t.Fatalf("NewIssue: %v", err)
+		}
+		_, err = model.UpdateIssue(ctx, &spb.ModelUpdateIssueRequest{
+			Id:     res.Id,
+			Author: &cpb.User{Username: "implr"},
+			Diff: &cpb.IssueStateDiff{
+				Assignee: &cpb.IssueStateDiff_MaybeUser{Value: &cpb.User{Username: "q3k"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("UpdateIssue: %v", err)
+		}
+
+		// Unknown usernames and IDs are rejected.
+		for _, u := range []*cpb.User{
+			{Username: "nonexistent"},
+			{Id: "c0ffee00-0000-0000-0000-000000000000"},
+			{Id: "notauuid"},
+		} {
+			_, err = newIssue(model, users["q3k"], u)
+			if want, got := codes.InvalidArgument, status.Code(err); want != got {
+				t.Errorf("NewIssue(assignee %v): wanted %v, got %v", u, want, got)
+			}
+			_, err = newIssue(model, u, users["q3k"])
+			if want, got := codes.InvalidArgument, status.Code(err); want != got {
+				t.Errorf("NewIssue(author %v): wanted %v, got %v", u, want, got)
+			}
+		}
+	})
+
+	t.Run("provision", func(t *testing.T) {
+		model, _, cancel := dutModelWithOptions(Options{AutoProvisionUsers: true})
+		defer cancel()
+
+		// Unknown authors get created, unknown assignees are still rejected.
+		_, err := newIssue(model, &cpb.User{Username: "informatic"}, &cpb.User{Username: "nonexistent"})
+		if want, got := codes.InvalidArgument, status.Code(err); want != got {
+			t.Fatalf("NewIssue(unknown assignee): wanted %v, got %v", want, got)
+		}
+		_, err = newIssue(model, &cpb.User{Username: "informatic"}, &cpb.User{Username: "q3k"})
+		if err != nil {
+			t.Fatalf("NewIssue(unknown author): %v", err)
+		}
+		res, err := model.GetUsers(ctx, &spb.ModelGetUsersRequest{
+			Usernames: []string{"informatic", "nonexistent"},
+		})
+		if err != nil {
+			t.Fatalf("GetUsers: %v", err)
+		}
+		if want, got := 1, len(res.Users); want != got {
+			t.Fatalf("GetUsers returned %d users, wanted %d", got, want)
+		}
+	})
+}
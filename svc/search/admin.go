@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// scanPageSize is the amount of documents retrieved at once when scanning
+// through the index.
+const scanPageSize = 1000
+
+// write applies a batch of changes to the index.
+func (s *service) write(batch *bleve.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bl.Batch(batch)
+}
+
+// scanPage returns a page of documents matching a query, in key order,
+// starting after a given key (or at the first document, if empty). Only the
+// given stored fields are retrieved.
+func (s *service) scanPage(q query.Query, after string, fields []string) (search.DocumentMatchCollection, error) {
+	searchRequest := bleve.NewSearchRequestOptions(q, scanPageSize, 0, false)
+	searchRequest.SortBy([]string{"_id"})
+	if after != "" {
+		searchRequest.SearchAfter = []string{after}
+	}
+	searchRequest.Fields = fields
+	searchResult, err := s.bl.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	return searchResult.Hits, nil
+}
+
+func (s *service) DeleteIssue(ctx context.Context, req *spb.DeleteIssueRequest) (*spb.DeleteIssueResponse, error) {
+	if req.Id <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "id must be valid")
+	}
+
+	batch := s.bl.NewBatch()
+	for _, key := range issueKeys(req.Id) {
+		batch.Delete(key)
+	}
+	id := float64(req.Id)
+	inclusive := true
+	updates := bleve.NewNumericRangeInclusiveQuery(&id, &id, &inclusive, &inclusive)
+	updates.SetField("issue_id")
+	after := ""
+	for {
+		hits, err := s.scanPage(updates, after, nil)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "bleve.Query: %v", err)
+		}
+		for _, hit := range hits {
+			batch.Delete(hit.ID)
+		}
+		if len(hits) < scanPageSize {
+			break
+		}
+		after = hits[len(hits)-1].ID
+	}
+
+	if err := s.write(batch); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "bleve.Delete: %v", err)
+	}
+	return &spb.DeleteIssueResponse{}, nil
+}
+
+func (s *service) DeleteUpdate(ctx context.Context, req *spb.DeleteUpdateRequest) (*spb.DeleteUpdateResponse, error) {
+	if req.IssueId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "issue_id must be valid")
+	}
+	if req.UpdateId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_id must be valid")
+	}
+
+	batch := s.bl.NewBatch()
+	for v := int64(1); v <= keyVersion; v++ {
+		batch.Delete(updateKey(v, req.IssueId, req.UpdateId))
+	}
+	if err := s.write(batch); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "bleve.Delete: %v", err)
+	}
+	return &spb.DeleteUpdateResponse{}, nil
+}
+
+// keyKind returns the kind of document with a given key, or KIND_INVALID if
+// the key could not be parsed.
+func keyKind(key string) spb.QueryResponse_Result_Kind {
+	if keyToIssueID(key) != 0 {
+		return spb.QueryResponse_Result_KIND_ISSUE
+	}
+	if issueID, _ := keyToUpdateID(key); issueID != 0 {
+		return spb.QueryResponse_Result_KIND_COMMENT
+	}
+	return spb.QueryResponse_Result_KIND_INVALID
+}
+
+func (s *service) GetIndexStats(ctx context.Context, req *spb.GetIndexStatsRequest) (*spb.GetIndexStatsResponse, error) {
+	res := &spb.GetIndexStatsResponse{
+		KeyVersion: keyVersion,
+	}
+
+	type kindVersion struct {
+		kind    spb.QueryResponse_Result_Kind
+		version int64
+	}
+	counts := make(map[kindVersion]int64)
+	after := ""
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		hits, err := s.scanPage(bleve.NewMatchAllQuery(), after, nil)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "bleve.Query: %v", err)
+		}
+		for _, hit := range hits {
+			kind := keyKind(hit.ID)
+			version := int64(0)
+			if kind != spb.QueryResponse_Result_KIND_INVALID {
+				version = keyVersionOf(hit.ID)
+			}
+			counts[kindVersion{kind, version}]++
+			res.TotalDocuments++
+		}
+		if len(hits) < scanPageSize {
+			break
+		}
+		after = hits[len(hits)-1].ID
+	}
+	for kv, count := range counts {
+		res.Documents = append(res.Documents, &spb.GetIndexStatsResponse_DocumentCount{
+			Kind:       kv.kind,
+			KeyVersion: kv.version,
+			Count:      count,
+		})
+	}
+	sort.Slice(res.Documents, func(i, j int) bool {
+		a, b := res.Documents[i], res.Documents[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.KeyVersion < b.KeyVersion
+	})
+
+	err := filepath.Walk(s.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			res.DiskSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not determine index size: %v", err)
+	}
+	return res, nil
+}
+
+// storedStrings converts a stored field value, which is a string for fields
+// with a single value, into a list of strings.
+func storedStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var res []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// rekey returns the key of a document in the current key version, and the
+// document rebuilt from its stored fields. The key is empty if the document
+// is of an unknown kind.
+func rekey(hit *search.DocumentMatch) (string, interface{}) {
+	if id := keyToIssueID(hit.ID); id != 0 {
+		title, _ := hit.Fields["title"].(string)
+		open, _ := hit.Fields["open"].(bool)
+		return issueIDToKey(id), &issue{
+			Title:    title,
+			Comments: storedStrings(hit.Fields["comments"]),
+			Open:     open,
+		}
+	}
+	if issueID, updateID := keyToUpdateID(hit.ID); issueID != 0 {
+		comment, _ := hit.Fields["comment"].(string)
+		return updateIDToKey(issueID, updateID), &update{
+			Comment: comment,
+			IssueID: issueID,
+		}
+	}
+	return "", nil
+}
+
+func (s *service) MigrateKeys(ctx context.Context, req *spb.MigrateKeysRequest) (*spb.MigrateKeysResponse, error) {
+	res := &spb.MigrateKeysResponse{
+		KeyVersion: keyVersion,
+	}
+
+	// Every page of documents is read and re-keyed while holding the write
+	// lock, so that documents can't change in between. Documents indexed
+	// in the meantime already have current keys, which are skipped.
+	migratePage := func(after string) (string, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		hits, err := s.scanPage(bleve.NewMatchAllQuery(), after, []string{"*"})
+		if err != nil {
+			return "", status.Errorf(codes.Unavailable, "bleve.Query: %v", err)
+		}
+		batch := s.bl.NewBatch()
+		migrated := int64(0)
+		for _, hit := range hits {
+			if keyVersionOf(hit.ID) == keyVersion {
+				continue
+			}
+			key, doc := rekey(hit)
+			if key == "" {
+				continue
+			}
+			if err := batch.Index(key, doc); err != nil {
+				return "", status.Errorf(codes.Unavailable, "bleve.Index: %v", err)
+			}
+			batch.Delete(hit.ID)
+			migrated++
+		}
+		if err := s.bl.Batch(batch); err != nil {
+			return "", status.Errorf(codes.Unavailable, "bleve.Index: %v", err)
+		}
+		res.Migrated += migrated
+		if len(hits) < scanPageSize {
+			return "", nil
+		}
+		return hits[len(hits)-1].ID, nil
+	}
+
+	after := ""
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var err error
+		after, err = migratePage(after)
+		if err != nil {
+			return nil, err
+		}
+		if after == "" {
+			return res, nil
+		}
+	}
+}
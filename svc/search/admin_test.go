@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	spb "github.com/q3k/bugless/proto/svc"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
+)
+
+// indexKeys returns the keys of all documents in the index of a service, in
+// key order.
+func indexKeys(t *testing.T, s *service) []string {
+	t.Helper()
+	hits, err := s.scanPage(bleve.NewMatchAllQuery(), "", nil)
+	if err != nil {
+		t.Fatalf("scanPage: %v", err)
+	}
+	res := []string{}
+	for _, hit := range hits {
+		res = append(res, hit.ID)
+	}
+	return res
+}
+
+func TestStoredStrings(t *testing.T) {
+	for _, te := range []struct {
+		v    interface{}
+		want []string
+	}{
+		{nil, nil},
+		{"foo", []string{"foo"}},
+		{[]interface{}{"foo", "bar"}, []string{"foo", "bar"}},
+		{[]interface{}{"foo", 1.0, "bar"}, []string{"foo", "bar"}},
+		{1.0, nil},
+	} {
+		if got := storedStrings(te.v); !reflect.DeepEqual(got, te.want) {
+			t.Errorf("storedStrings(%v) is %v, wanted %v", te.v, got, te.want)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	defer func(v int64) { keyVersion = v }(keyVersion)
+	keyVersion = 2
+
+	for _, te := range []struct {
+		hit  *search.DocumentMatch
+		key  string
+		want interface{}
+	}{
+		{
+			hit: &search.DocumentMatch{
+				ID: "issue/v1/1234",
+				Fields: map[string]interface{}{
+					"title":    "foo",
+					"comments": []interface{}{"bar", "baz"},
+					"open":     true,
+				},
+			},
+			key: "issue/v2/1234",
+			want: &issue{
+				Title:    "foo",
+				Comments: []string{"bar", "baz"},
+				Open:     true,
+			},
+		},
+		{
+			hit: &search.DocumentMatch{
+				ID: "issue/v1/1234",
+				Fields: map[string]interface{}{
+					"title":    "foo",
+					"comments": "bar",
+				},
+			},
+			key: "issue/v2/1234",
+			want: &issue{
+				Title:    "foo",
+				Comments: []string{"bar"},
+			},
+		},
+		{
+			hit: &search.DocumentMatch{
+				ID: "update/v1/1234/5678",
+				Fields: map[string]interface{}{
+					"comment":  "foo",
+					"issue_id": 1234.0,
+				},
+			},
+			key: "update/v2/1234/5678",
+			want: &update{
+				Comment: "foo",
+				IssueID: 1234,
+			},
+		},
+		{
+			hit: &search.DocumentMatch{
+				ID: "comment/v1/1234",
+			},
+			key:  "",
+			want: nil,
+		},
+	} {
+		key, doc := rekey(te.hit)
+		if key != te.key || !reflect.DeepEqual(doc, te.want) {
+			t.Errorf("rekey(%q) is (%q, %+v), wanted (%q, %+v)", te.hit.ID, key, doc, te.key, te.want)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	s := dut(t)
+
+	for _, id := range []int64{1, 2} {
+		if _, err := s.IndexIssue(ctx, &spb.IndexIssueRequest{Id: id, Title: "foo"}); err != nil {
+			t.Fatalf("IndexIssue(%d): %v", id, err)
+		}
+		for _, updateID := range []int64{1, 2} {
+			if _, err := s.IndexUpdate(ctx, &spb.IndexUpdateRequest{IssueId: id, UpdateId: updateID, Comment: "bar"}); err != nil {
+				t.Fatalf("IndexUpdate(%d, %d): %v", id, updateID, err)
+			}
+		}
+	}
+
+	if _, err := s.DeleteUpdate(ctx, &spb.DeleteUpdateRequest{IssueId: 2, UpdateId: 1}); err != nil {
+		t.Fatalf("DeleteUpdate: %v", err)
+	}
+	want := []string{"issue/v1/1", "issue/v1/2", "update/v1/1/1", "update/v1/1/2", "update/v1/2/2"}
+	if got := indexKeys(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("after DeleteUpdate, index contains %v, wanted %v", got, want)
+	}
+
+	// Deleting an issue also deletes its updates.
+	if _, err := s.DeleteIssue(ctx, &spb.DeleteIssueRequest{Id: 1}); err != nil {
+		t.Fatalf("DeleteIssue: %v", err)
+	}
+	want = []string{"issue/v1/2", "update/v1/2/2"}
+	if got := indexKeys(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("after DeleteIssue, index contains %v, wanted %v", got, want)
+	}
+
+	// Documents with older key versions are deleted, too.
+	defer func(v int64) { keyVersion = v }(keyVersion)
+	keyVersion = 2
+	if _, err := s.DeleteIssue(ctx, &spb.DeleteIssueRequest{Id: 2}); err != nil {
+		t.Fatalf("DeleteIssue: %v", err)
+	}
+	if got := indexKeys(t, s); len(got) != 0 {
+		t.Errorf("after deleting all issues, index contains %v", got)
+	}
+
+	if _, err := s.DeleteIssue(ctx, &spb.DeleteIssueRequest{}); err == nil {
+		t.Errorf("DeleteIssue without id succeeded")
+	}
+	if _, err := s.DeleteUpdate(ctx, &spb.DeleteUpdateRequest{IssueId: 1}); err == nil {
+		t.Errorf("DeleteUpdate without update_id succeeded")
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	ctx := context.Background()
+	s := dut(t)
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "store"), []byte("1234"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s.path = dir
+
+	// Documents are indexed with version 1 keys, then the key version is
+	// bumped and another issue is indexed with a version 2 key.
+	defer func(v int64) { keyVersion = v }(keyVersion)
+	keyVersion = 1
+	_, err = s.IndexIssue(ctx, &spb.IndexIssueRequest{Id: 1, Title: "crash on startup", Comments: []string{"foo", "bar"}, Open: true})
+	if err != nil {
+		t.Fatalf("IndexIssue: %v", err)
+	}
+	if _, err := s.IndexUpdate(ctx, &spb.IndexUpdateRequest{IssueId: 1, UpdateId: 1, Comment: "still crashing"}); err != nil {
+		t.Fatalf("IndexUpdate: %v", err)
+	}
+	if _, err := s.IndexIssue(ctx, &spb.IndexIssueRequest{Id: 2, Title: "slow startup"}); err != nil {
+		t.Fatalf("IndexIssue: %v", err)
+	}
+	keyVersion = 2
+	if _, err := s.IndexIssue(ctx, &spb.IndexIssueRequest{Id: 3, Title: "crash on shutdown"}); err != nil {
+		t.Fatalf("IndexIssue: %v", err)
+	}
+
+	stats, err := s.GetIndexStats(ctx, &spb.GetIndexStatsRequest{})
+	if err != nil {
+		t.Fatalf("GetIndexStats: %v", err)
+	}
+	if want, got := int64(2), stats.KeyVersion; want != got {
+		t.Errorf("key_version is %d, wanted %d", got, want)
+	}
+	if want, got := int64(4), stats.TotalDocuments; want != got {
+		t.Errorf("total_documents is %d, wanted %d", got, want)
+	}
+	if want, got := int64(4), stats.DiskSize; want != got {
+		t.Errorf("disk_size is %d, wanted %d", got, want)
+	}
+	var counts []string
+	for _, c := range stats.Documents {
+		counts = append(counts, fmt.Sprintf("%s/v%d: %d", c.Kind, c.KeyVersion, c.Count))
+	}
+	wantCounts := []string{"KIND_ISSUE/v1: 2", "KIND_ISSUE/v2: 1", "KIND_COMMENT/v1: 1"}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("documents are %v, wanted %v", counts, wantCounts)
+	}
+
+	res, err := s.MigrateKeys(ctx, &spb.MigrateKeysRequest{})
+	if err != nil {
+		t.Fatalf("MigrateKeys: %v", err)
+	}
+	if want, got := int64(3), res.Migrated; want != got {
+		t.Errorf("migrated %d documents, wanted %d", got, want)
+	}
+	want := []string{"issue/v2/1", "issue/v2/2", "issue/v2/3", "update/v2/1/1"}
+	if got := indexKeys(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("after MigrateKeys, index contains %v, wanted %v", got, want)
+	}
+
+	// Migrated documents are still found by their contents.
+	for _, te := range []struct {
+		query string
+		want  []string
+	}{
+		{"title:crash", []string{"issue 1", "issue 3"}},
+		{"comments:bar", []string{"issue 1"}},
+		{"comment:still", []string{"comment 1/1"}},
+	} {
+		var got []string
+		for _, r := range runQuery(t, s, &spb.QueryRequest{Query: te.query}) {
+			for _, result := range r.Results {
+				if i := result.GetIssue(); i != nil {
+					got = append(got, fmt.Sprintf("issue %d", i.Id))
+				}
+				if c := result.GetComment(); c != nil {
+					got = append(got, fmt.Sprintf("comment %d/%d", c.IssueId, c.UpdateId))
+				}
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(te.want) {
+			t.Errorf("query %q returned %v, wanted %v", te.query, got, te.want)
+		}
+	}
+
+	// Only issue 1 is open.
+	dups, err := s.SuggestDuplicates(ctx, &spb.SuggestDuplicatesRequest{Title: "crash"})
+	if err != nil {
+		t.Fatalf("SuggestDuplicates: %v", err)
+	}
+	if len(dups.Suggestions) != 1 || dups.Suggestions[0].IssueId != 1 {
+		t.Errorf("SuggestDuplicates returned %v, wanted issue 1", dups.Suggestions)
+	}
+
+	// Migrating again is a no-op.
+	res, err = s.MigrateKeys(ctx, &spb.MigrateKeysRequest{})
+	if err != nil {
+		t.Fatalf("MigrateKeys: %v", err)
+	}
+	if want, got := int64(0), res.Migrated; want != got {
+		t.Errorf("second migration migrated %d documents, wanted %d", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+const (
+	// defaultSuggestions is the amount of duplicate suggestions returned if
+	// not requested otherwise.
+	defaultSuggestions = 10
+	// maxSuggestions is the maximum amount of duplicate suggestions that can
+	// be requested.
+	maxSuggestions = 100
+)
+
+// similarityQuery returns a query matching issues with any of the words of a
+// draft issue's title and body, scoring them by how many (and how rare) words
+// they share with it. Titles are compared with each other, and weigh more
+// than the rest of the text.
+func similarityQuery(title, body string) query.Query {
+	q := bleve.NewDisjunctionQuery()
+	add := func(text, field string, boost float64) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		for _, f := range []string{field, field + "_identifiers"} {
+			m := bleve.NewMatchQuery(text)
+			m.SetField(f)
+			m.SetBoost(boost)
+			q.AddQuery(m)
+		}
+	}
+	add(title, "title", 2)
+	add(title+"\n"+body, "comments", 1)
+	return q
+}
+
+func (s *service) SuggestDuplicates(ctx context.Context, req *spb.SuggestDuplicatesRequest) (*spb.SuggestDuplicatesResponse, error) {
+	if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Body) == "" {
+		return nil, status.Error(codes.InvalidArgument, "title or body must be set")
+	}
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultSuggestions
+	case limit < 0 || limit > maxSuggestions:
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", maxSuggestions)
+	}
+	if req.ExcludeIssueId < 0 {
+		return nil, status.Error(codes.InvalidArgument, "exclude_issue_id must be valid")
+	}
+
+	// Only issue documents have the open field, so this never matches
+	// updates.
+	open := bleve.NewBoolFieldQuery(true)
+	open.SetField("open")
+	q := bleve.NewBooleanQuery()
+	q.AddMust(similarityQuery(req.Title, req.Body), open)
+	if req.ExcludeIssueId != 0 {
+		q.AddMustNot(bleve.NewDocIDQuery(issueKeys(req.ExcludeIssueId)))
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(q, int(limit), 0, false)
+	searchRequest.SortBy(querySort)
+	searchResult, err := s.bl.Search(searchRequest)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "bleve.Query: %v", err)
+	}
+
+	res := &spb.SuggestDuplicatesResponse{}
+	for _, hit := range searchResult.Hits {
+		id := keyToIssueID(hit.ID)
+		if id == 0 {
+			continue
+		}
+		res.Suggestions = append(res.Suggestions, &spb.SuggestDuplicatesResponse_Suggestion{
+			IssueId: id,
+			Score:   hit.Score,
+		})
+	}
+	return res, nil
+}
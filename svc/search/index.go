@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/blevesearch/bleve"
+	log "github.com/inconshreveable/log15"
+)
+
+var (
+	// internalMappingVersion is the internal key under which the
+	// mappingVersion of an index is stored. Indexes without it were created
+	// with mapping version 1.
+	internalMappingVersion = []byte("bugless/mapping_version")
+	// internalIndexID is the internal key under which the random ID of an
+	// index is stored.
+	internalIndexID = []byte("bugless/index_id")
+)
+
+// openIndex opens the index at a given path, creating it if it doesn't exist
+// yet. An index created with an older mapping is deleted and created from
+// scratch, with a new ID. Returns the index and its ID.
+func openIndex(l log.Logger, path string) (bleve.Index, string, error) {
+	if _, err := os.Stat(path); err == nil {
+		l.Info("Opening index", "path", path)
+		bl, err := bleve.Open(path)
+		if err != nil {
+			return nil, "", err
+		}
+		version, err := indexMappingVersion(bl)
+		if err != nil {
+			bl.Close()
+			return nil, "", err
+		}
+		if version == mappingVersion {
+			id, err := bl.GetInternal(internalIndexID)
+			if err != nil {
+				bl.Close()
+				return nil, "", err
+			}
+			return bl, string(id), nil
+		}
+
+		l.Warn("Index mapping is outdated, rebuilding index", "path", path, "version", version, "want", mappingVersion)
+		if err := bl.Close(); err != nil {
+			return nil, "", err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return nil, "", err
+		}
+	}
+
+	l.Info("Creating new index", "path", path)
+	return createIndex(path)
+}
+
+// indexMappingVersion returns the mapping version with which an index was
+// created.
+func indexMappingVersion(bl bleve.Index) (int64, error) {
+	data, err := bl.GetInternal(internalMappingVersion)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 1, nil
+	}
+	version, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mapping version %q: %w", data, err)
+	}
+	return version, nil
+}
+
+// createIndex creates an index with the current mapping and a new random ID.
+func createIndex(path string) (bleve.Index, string, error) {
+	mapping, err := createMapping()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid mapping: %w", err)
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+
+	bl, err := bleve.New(path, mapping)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := bl.SetInternal(internalIndexID, []byte(id)); err != nil {
+		bl.Close()
+		return nil, "", err
+	}
+	// The version is written last, so that an index that's only partially
+	// set up gets rebuilt.
+	if err := bl.SetInternal(internalMappingVersion, []byte(strconv.FormatInt(mappingVersion, 10))); err != nil {
+		bl.Close()
+		return nil, "", err
+	}
+	return bl, id, nil
+}
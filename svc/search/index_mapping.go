@@ -9,11 +9,22 @@ import (
 	"strings"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	regexpCharFilter "github.com/blevesearch/bleve/analysis/char/regexp"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/token/camelcase"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/token/porter"
+	regexpTokenizer "github.com/blevesearch/bleve/analysis/tokenizer/regexp"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
 	"github.com/blevesearch/bleve/mapping"
 )
 
+// Document fields are named after their mappings in createMapping.
 type issue struct {
-	Title string
+	Title    string   `json:"title"`
+	Comments []string `json:"comments"`
+	Open     bool     `json:"open"`
 }
 
 func (i *issue) Type() string {
@@ -21,44 +32,218 @@ func (i *issue) Type() string {
 }
 
 type update struct {
-	Comment string
+	Comment string `json:"comment"`
+	IssueID int64  `json:"issue_id"`
 }
 
 func (u *update) Type() string {
 	return "update"
 }
 
-func createMapping() *mapping.IndexMappingImpl {
+// mappingVersion is the version of the index mapping returned by
+// createMapping. It must be bumped on every change to the mapping (including
+// its analyzers), so that indexes created with an older mapping get rebuilt.
+//
+// Version 1 used bleve's default text analyzer, version 2 introduced the
+// code-aware analyzers, version 3 added whether issues are open, version 4
+// added the issue ID of updates.
+const mappingVersion = 4
+
+const (
+	// codeAnalyzer analyzes text as English prose that can contain code:
+	// camelCase and snake_case identifiers are split into words, and all
+	// words are stemmed. This way, ResolveUsername matches 'resolve username'
+	// and vice versa. This is also the analyzer of search queries.
+	codeAnalyzer = "bugless_code"
+	// identifierAnalyzer analyzes text as a list of identifiers, file paths
+	// (like svc/model/db.go) and error codes (like ERR-42), keeping each of
+	// them whole. Tokens are stemmed like by codeAnalyzer, so that
+	// errnochange (analyzed by codeAnalyzer) matches ErrNoChange.
+	identifierAnalyzer = "bugless_identifier"
+
+	snakeCaseCharFilter = "bugless_snake_case"
+	identifierTokenizer = "bugless_identifier"
+)
+
+// textFieldMappings returns the mappings of a full text field: one with the
+// text analyzed by codeAnalyzer, and one (with an _identifiers suffix) with
+// the text analyzed by identifierAnalyzer. Field values are stored alongside
+// term vectors, so that search results can be highlighted.
+func textFieldMappings(name string) []*mapping.FieldMapping {
+	text := bleve.NewTextFieldMapping()
+	text.Name = name
+	text.Analyzer = codeAnalyzer
+	text.Store = true
+	text.IncludeTermVectors = true
+
+	identifiers := bleve.NewTextFieldMapping()
+	identifiers.Name = name + "_identifiers"
+	identifiers.Analyzer = identifierAnalyzer
+	identifiers.Store = false
+	return []*mapping.FieldMapping{text, identifiers}
+}
+
+// addAnalyzers adds the custom analyzers to a mapping.
+func addAnalyzers(m *mapping.IndexMappingImpl) error {
+	err := m.AddCustomCharFilter(snakeCaseCharFilter, map[string]interface{}{
+		"type":    regexpCharFilter.Name,
+		"regexp":  `_`,
+		"replace": " ",
+	})
+	if err != nil {
+		return err
+	}
+	// Runs of letters, digits and underscores, joined by dots, slashes or
+	// dashes.
+	err = m.AddCustomTokenizer(identifierTokenizer, map[string]interface{}{
+		"type":   regexpTokenizer.Name,
+		"regexp": `[\p{L}\p{N}_]+(?:[./-][\p{L}\p{N}_]+)*`,
+	})
+	if err != nil {
+		return err
+	}
+	err = m.AddCustomAnalyzer(codeAnalyzer, map[string]interface{}{
+		"type":         custom.Name,
+		"char_filters": []string{snakeCaseCharFilter},
+		"tokenizer":    unicode.Name,
+		"token_filters": []string{
+			camelcase.Name,
+			lowercase.Name,
+			en.PossessiveName,
+			porter.Name,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return m.AddCustomAnalyzer(identifierAnalyzer, map[string]interface{}{
+		"type":      custom.Name,
+		"tokenizer": identifierTokenizer,
+		"token_filters": []string{
+			lowercase.Name,
+			porter.Name,
+		},
+	})
+}
+
+func createMapping() (*mapping.IndexMappingImpl, error) {
 	mapping := bleve.NewIndexMapping()
+	if err := addAnalyzers(mapping); err != nil {
+		return nil, err
+	}
+	mapping.DefaultAnalyzer = codeAnalyzer
 
 	issueMapping := bleve.NewDocumentMapping()
-	titleFieldNameMapping := bleve.NewTextFieldMapping()
-	titleFieldNameMapping.Name = "title"
-	issueMapping.AddFieldMappingsAt("title", titleFieldNameMapping)
+	issueMapping.AddFieldMappingsAt("title", textFieldMappings("title")...)
+	issueMapping.AddFieldMappingsAt("comments", textFieldMappings("comments")...)
+	openMapping := bleve.NewBooleanFieldMapping()
+	openMapping.IncludeInAll = false
+	issueMapping.AddFieldMappingsAt("open", openMapping)
 	mapping.AddDocumentMapping("issue", issueMapping)
 
 	updateMapping := bleve.NewDocumentMapping()
-	commentFieldNameMapping := bleve.NewTextFieldMapping()
-	updateMapping.AddFieldMappingsAt("comment", commentFieldNameMapping)
+	updateMapping.AddFieldMappingsAt("comment", textFieldMappings("comment")...)
+	issueIDMapping := bleve.NewNumericFieldMapping()
+	issueIDMapping.IncludeInAll = false
+	updateMapping.AddFieldMappingsAt("issue_id", issueIDMapping)
 	mapping.AddDocumentMapping("update", updateMapping)
-	return mapping
+	return mapping, mapping.Validate()
 }
 
+// keyVersion is the version of the schema of document keys written by this
+// service. Documents with keys of older versions are still found by queries,
+// and can be re-keyed to this version by MigrateKeys.
+//
+// Keys have the form <kind>/v<version>/<ids...>, eg. issue/v1/1234 and
+// update/v1/1234/5678.
+//
+// This is only a variable so that tests can bump it.
+var keyVersion int64 = 1
+
 // issueIDToKey turns a numeric issue number into an internal search ID.
 func issueIDToKey(id int64) string {
-	return fmt.Sprintf("issue/v1/%d", id)
+	return issueKey(keyVersion, id)
+}
+
+// issueKey turns a numeric issue number into an internal search ID of a given
+// key version.
+func issueKey(version, id int64) string {
+	return fmt.Sprintf("issue/v%d/%d", version, id)
+}
+
+// issueKeys returns the internal search IDs of an issue in all key versions
+// up to the current one.
+func issueKeys(id int64) []string {
+	var res []string
+	for v := int64(1); v <= keyVersion; v++ {
+		res = append(res, issueKey(v, id))
+	}
+	return res
 }
 
 // keyToIssueID tries to convert an internal serach ID into an issue number. It
 // returns 0 if the given internal ID could not be parsed as an issue ID.
 func keyToIssueID(id string) int64 {
-	if !strings.HasPrefix(id, "issue/v1/") {
+	_, ids := parseKey(id, "issue", 1)
+	if ids == nil {
 		return 0
 	}
+	return ids[0]
+}
 
-	val, err := strconv.ParseInt(id[len("issue/v1/"):], 10, 64)
-	if err != nil {
-		return 0
+// updateIDToKey turns a numeric issue and update number into an internal search
+// ID.
+func updateIDToKey(issueID, updateID int64) string {
+	return updateKey(keyVersion, issueID, updateID)
+}
+
+// updateKey turns a numeric issue and update number into an internal search
+// ID of a given key version.
+func updateKey(version, issueID, updateID int64) string {
+	return fmt.Sprintf("update/v%d/%d/%d", version, issueID, updateID)
+}
+
+// keyToUpdateID tries to convert an internal search ID into an issue and
+// update number. It returns zeroes if the given internal ID could not be
+// parsed as an update ID.
+func keyToUpdateID(id string) (int64, int64) {
+	_, ids := parseKey(id, "update", 2)
+	if ids == nil {
+		return 0, 0
+	}
+	return ids[0], ids[1]
+}
+
+// keyVersionOf returns the key version of an internal search ID, or 0 if it
+// could not be parsed.
+func keyVersionOf(id string) int64 {
+	if version, ids := parseKey(id, "issue", 1); ids != nil {
+		return version
+	}
+	if version, ids := parseKey(id, "update", 2); ids != nil {
+		return version
+	}
+	return 0
+}
+
+// parseKey tries to parse an internal search ID of a given kind, with a given
+// amount of numeric IDs after the version. It returns the key version and the
+// IDs, or nil IDs if the internal ID could not be parsed.
+func parseKey(id, kind string, n int) (int64, []int64) {
+	parts := strings.Split(id, "/")
+	if len(parts) != n+2 || parts[0] != kind || !strings.HasPrefix(parts[1], "v") {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(parts[1][1:], 10, 64)
+	if err != nil || version < 1 {
+		return 0, nil
+	}
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i], err = strconv.ParseInt(parts[i+2], 10, 64)
+		if err != nil {
+			return 0, nil
+		}
 	}
-	return val
+	return version, ids
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	for _, te := range []struct {
+		key     string
+		kind    string
+		n       int
+		version int64
+		ids     []int64
+	}{
+		{"issue/v1/1234", "issue", 1, 1, []int64{1234}},
+		{"issue/v23/1234", "issue", 1, 23, []int64{1234}},
+		{"update/v1/1234/5678", "update", 2, 1, []int64{1234, 5678}},
+		// Wrong kind or amount of IDs.
+		{"issue/v1/1234", "update", 2, 0, nil},
+		{"update/v1/1234/5678", "issue", 1, 0, nil},
+		{"issue/v1/1234/5678", "issue", 1, 0, nil},
+		{"update/v1/1234", "update", 2, 0, nil},
+		// Invalid versions.
+		{"issue/1/1234", "issue", 1, 0, nil},
+		{"issue/v/1234", "issue", 1, 0, nil},
+		{"issue/v0/1234", "issue", 1, 0, nil},
+		{"issue/v-1/1234", "issue", 1, 0, nil},
+		{"issue/vfoo/1234", "issue", 1, 0, nil},
+		// Invalid IDs.
+		{"issue/v1/", "issue", 1, 0, nil},
+		{"issue/v1/foo", "issue", 1, 0, nil},
+		{"update/v1/1234/foo", "update", 2, 0, nil},
+		{"", "issue", 1, 0, nil},
+	} {
+		version, ids := parseKey(te.key, te.kind, te.n)
+		if version != te.version || fmt.Sprint(ids) != fmt.Sprint(te.ids) {
+			t.Errorf("parseKey(%q, %q, %d) is (%d, %v), wanted (%d, %v)", te.key, te.kind, te.n, version, ids, te.version, te.ids)
+		}
+	}
+}
+
+func TestKeyVersionOf(t *testing.T) {
+	for _, te := range []struct {
+		key     string
+		version int64
+	}{
+		{"issue/v1/1234", 1},
+		{"issue/v2/1234", 2},
+		{"update/v1/1234/5678", 1},
+		{"update/v3/1234/5678", 3},
+		{"issue/v2/1234/5678", 0},
+		{"comment/v1/1234", 0},
+		{"1234", 0},
+		{"", 0},
+	} {
+		if got := keyVersionOf(te.key); got != te.version {
+			t.Errorf("keyVersionOf(%q) is %d, wanted %d", te.key, got, te.version)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	if want, got := int64(1234), keyToIssueID(issueIDToKey(1234)); want != got {
+		t.Errorf("issue key round trip is %d, wanted %d", got, want)
+	}
+	issueID, updateID := keyToUpdateID(updateIDToKey(1234, 5678))
+	if issueID != 1234 || updateID != 5678 {
+		t.Errorf("update key round trip is (%d, %d), wanted (1234, 5678)", issueID, updateID)
+	}
+	if want, got := int64(0), keyToIssueID(updateIDToKey(1234, 5678)); want != got {
+		t.Errorf("keyToIssueID of update key is %d, wanted %d", got, want)
+	}
+
+	defer func(v int64) { keyVersion = v }(keyVersion)
+	keyVersion = 3
+	if want, got := "issue/v3/1234", issueIDToKey(1234); want != got {
+		t.Errorf("issueIDToKey is %q, wanted %q", got, want)
+	}
+	if want, got := "[issue/v1/1234 issue/v2/1234 issue/v3/1234]", fmt.Sprint(issueKeys(1234)); want != got {
+		t.Errorf("issueKeys is %s, wanted %s", got, want)
+	}
+}
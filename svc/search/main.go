@@ -5,12 +5,10 @@ package main
 
 import (
 	"flag"
-	"os"
 
 	"code.hackerspace.pl/hscloud/go/mirko"
 	spb "github.com/q3k/bugless/proto/svc"
 
-	"github.com/blevesearch/bleve"
 	log "github.com/inconshreveable/log15"
 )
 
@@ -29,23 +27,16 @@ func main() {
 		return
 	}
 
-	var bl bleve.Index
-	var err error
-	if _, err := os.Stat(flagLocalStorage); err == nil {
-		log.Info("Opening index", "path", flagLocalStorage)
-		bl, err = bleve.Open(flagLocalStorage)
-	} else {
-		log.Info("Creating new index", "path", flagLocalStorage)
-		mapping := createMapping()
-		bl, err = bleve.New(flagLocalStorage, mapping)
-	}
+	bl, id, err := openIndex(l, flagLocalStorage)
 	if err != nil {
 		l.Crit("could not create or open bleve index", "err", err)
 		return
 	}
 
 	s := &service{
-		bl: bl,
+		bl:   bl,
+		id:   id,
+		path: flagLocalStorage,
 	}
 	spb.RegisterSearchServer(m.GRPC(), s)
 
@@ -2,16 +2,37 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	spb "github.com/q3k/bugless/proto/svc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search"
 )
 
 type service struct {
 	bl bleve.Index
+	// id is the random ID of the index, see GetIndexInfoResponse.
+	id string
+	// path is the path of the index on disk.
+	path string
+
+	// mu serializes writes to the index with key migrations, so that a
+	// document being migrated can't be overwritten by its stale copy.
+	mu sync.Mutex
+}
+
+func (s *service) GetIndexInfo(ctx context.Context, req *spb.GetIndexInfoRequest) (*spb.GetIndexInfoResponse, error) {
+	return &spb.GetIndexInfoResponse{
+		IndexId:        s.id,
+		MappingVersion: mappingVersion,
+	}, nil
 }
 
 func (s *service) IndexIssue(ctx context.Context, req *spb.IndexIssueRequest) (*spb.IndexIssueResponse, error) {
@@ -22,75 +43,261 @@ func (s *service) IndexIssue(ctx context.Context, req *spb.IndexIssueRequest) (*
 		return &spb.IndexIssueResponse{}, nil
 	}
 
-	err := s.bl.Index(issueIDToKey(req.Id), &issue{
-		Title: req.Title,
+	// Copies of the document with older key versions are replaced.
+	batch := s.bl.NewBatch()
+	err := batch.Index(issueIDToKey(req.Id), &issue{
+		Title:    req.Title,
+		Comments: req.Comments,
+		Open:     req.Open,
 	})
 	if err != nil {
 		return nil, status.Errorf(codes.Unavailable, "bleve.Index: %v", err)
 	}
+	for v := int64(1); v < keyVersion; v++ {
+		batch.Delete(issueKey(v, req.Id))
+	}
+	if err := s.write(batch); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "bleve.Index: %v", err)
+	}
 
 	return &spb.IndexIssueResponse{}, nil
 }
 
+func (s *service) IndexUpdate(ctx context.Context, req *spb.IndexUpdateRequest) (*spb.IndexUpdateResponse, error) {
+	if req.IssueId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "issue_id must be valid")
+	}
+	if req.UpdateId <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_id must be valid")
+	}
+	if len(req.Comment) == 0 {
+		return &spb.IndexUpdateResponse{}, nil
+	}
+
+	batch := s.bl.NewBatch()
+	err := batch.Index(updateIDToKey(req.IssueId, req.UpdateId), &update{
+		Comment: req.Comment,
+		IssueID: req.IssueId,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "bleve.Index: %v", err)
+	}
+	for v := int64(1); v < keyVersion; v++ {
+		batch.Delete(updateKey(v, req.IssueId, req.UpdateId))
+	}
+	if err := s.write(batch); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "bleve.Index: %v", err)
+	}
+
+	return &spb.IndexUpdateResponse{}, nil
+}
+
+const (
+	// defaultPageSize is the amount of results per QueryResponse if not
+	// requested otherwise.
+	defaultPageSize = 100
+	// maxPageSize is the maximum amount of results per QueryResponse.
+	maxPageSize = 1000
+)
+
+// querySort is the ordering of query results: best first, then by document
+// ID, so that the ordering is total and pages don't overlap.
+var querySort = []string{"-_score", "_id"}
+
+// encodeCursor returns an opaque cursor pointing at a result, given its
+// offset within all results.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset of the result pointed to by a cursor.
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	return offset, nil
+}
+
 func (s *service) Query(req *spb.QueryRequest, srv spb.Search_QueryServer) error {
 	if req.Query == "" {
 		return nil
 	}
-	query := bleve.NewQueryStringQuery(req.Query)
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Fields = []string{"*"}
-	searchRequest.IncludeLocations = true
-	searchResult, err := s.bl.Search(searchRequest)
-	if err != nil {
-		return status.Errorf(codes.Unavailable, "bleve.Query: %v", err)
+	pageSize := req.PageSize
+	switch {
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize < 0 || pageSize > maxPageSize:
+		return status.Errorf(codes.InvalidArgument, "page_size must be between 0 and %d", maxPageSize)
+	}
+	if req.Offset < 0 {
+		return status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+	offset := int(req.Offset)
+	if req.Cursor != "" {
+		if req.Offset != 0 {
+			return status.Error(codes.InvalidArgument, "offset and cursor cannot be combined")
+		}
+		var err error
+		offset, err = decodeCursor(req.Cursor)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid cursor: %v", err)
+		}
 	}
 
-	res := []*spb.QueryResponse_Result{}
-	for _, hit := range searchResult.Hits {
-		result := &spb.QueryResponse_Result{
-			LocationsByTermField: make(map[string]*spb.QueryResponse_LocationsByTerm),
+	// Results are retrieved from bleve a page at a time, continuing at the
+	// offset after the last result of the previous page, until there are no
+	// more results or the client stops reading.
+	ctx := srv.Context()
+	for {
+		query := bleve.NewQueryStringQuery(req.Query)
+		searchRequest := bleve.NewSearchRequestOptions(query, int(pageSize), offset, false)
+		searchRequest.SortBy(querySort)
+		searchRequest.Fields = []string{"*"}
+		searchRequest.IncludeLocations = true
+		searchRequest.Highlight = bleve.NewHighlightWithStyle("html")
+		searchResult, err := s.bl.Search(searchRequest)
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "bleve.Query: %v", err)
 		}
 
-		for field, v := range hit.Locations {
-			fieldData := ""
-			if _, ok := hit.Fields[field]; ok {
-				if _, ok := hit.Fields[field].(string); ok {
-					fieldData = hit.Fields[field].(string)
-				}
+		res := &spb.QueryResponse{
+			Results:   []*spb.QueryResponse_Result{},
+			TotalHits: searchResult.Total,
+			MaxScore:  searchResult.MaxScore,
+		}
+		for _, hit := range searchResult.Hits {
+			if result := queryResult(hit); result != nil {
+				res.Results = append(res.Results, result)
 			}
-			lbt := &spb.QueryResponse_LocationsByTerm{
-				LocationsByTerm: make(map[string]*spb.QueryResponse_Locations),
-				FieldData:       fieldData,
+		}
+		offset += len(searchResult.Hits)
+		more := len(searchResult.Hits) == int(pageSize)
+		if more {
+			res.NextCursor = encodeCursor(offset)
+		}
+		if err := srv.Send(res); err != nil {
+			return err
+		}
+		if !more || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// queryResult converts a bleve search hit into a query result, or nil if the
+// hit is not a known document.
+func queryResult(hit *search.DocumentMatch) *spb.QueryResponse_Result {
+	result := &spb.QueryResponse_Result{
+		LocationsByTermField: make(map[string]*spb.QueryResponse_LocationsByTerm),
+		Score:                hit.Score,
+	}
+
+	for field, v := range hit.Locations {
+		fieldData := ""
+		if _, ok := hit.Fields[field]; ok {
+			if _, ok := hit.Fields[field].(string); ok {
+				fieldData = hit.Fields[field].(string)
 			}
-			for term, v2 := range v {
-				locs := make([]*spb.QueryResponse_Location, len(v2))
-				for i, location := range v2 {
-					locs[i] = &spb.QueryResponse_Location{
-						Pos:   location.Pos,
-						Start: location.Start,
-						End:   location.End,
-					}
-				}
-				lbt.LocationsByTerm[term] = &spb.QueryResponse_Locations{
-					Locations: locs,
+		}
+		lbt := &spb.QueryResponse_LocationsByTerm{
+			LocationsByTerm: make(map[string]*spb.QueryResponse_Locations),
+			FieldData:       fieldData,
+		}
+		for term, v2 := range v {
+			locs := make([]*spb.QueryResponse_Location, len(v2))
+			for i, location := range v2 {
+				locs[i] = &spb.QueryResponse_Location{
+					Pos:   location.Pos,
+					Start: location.Start,
+					End:   location.End,
 				}
 			}
-			result.LocationsByTermField[field] = lbt
+			lbt.LocationsByTerm[term] = &spb.QueryResponse_Locations{
+				Locations: locs,
+			}
 		}
+		result.LocationsByTermField[field] = lbt
+	}
 
-		issueId := keyToIssueID(hit.ID)
-		if issueId != 0 {
-			result.Kind = spb.QueryResponse_Result_KIND_ISSUE
-			result.Payload = &spb.QueryResponse_Result_Issue{
-				Issue: &spb.QueryResponse_Issue{
-					Id: issueId,
-				},
-			}
-			res = append(res, result)
+	for field, fragments := range hit.Fragments {
+		fs := &spb.QueryResponse_Fragments{}
+		for _, f := range fragments {
+			fs.Fragments = append(fs.Fragments, parseFragment(f))
+		}
+		if result.FragmentsByField == nil {
+			result.FragmentsByField = make(map[string]*spb.QueryResponse_Fragments)
 		}
+		result.FragmentsByField[field] = fs
 	}
 
-	return srv.Send(&spb.QueryResponse{
-		Results: res,
-	})
+	issueId := keyToIssueID(hit.ID)
+	if issueId != 0 {
+		result.Kind = spb.QueryResponse_Result_KIND_ISSUE
+		result.Payload = &spb.QueryResponse_Result_Issue{
+			Issue: &spb.QueryResponse_Issue{
+				Id: issueId,
+			},
+		}
+		return result
+	}
+
+	issueId, updateId := keyToUpdateID(hit.ID)
+	if issueId != 0 {
+		result.Kind = spb.QueryResponse_Result_KIND_COMMENT
+		result.Payload = &spb.QueryResponse_Result_Comment{
+			Comment: &spb.QueryResponse_Comment{
+				IssueId:  issueId,
+				UpdateId: updateId,
+			},
+		}
+		return result
+	}
+	return nil
+}
+
+const (
+	// highlightBefore and highlightAfter surround found terms in fragments
+	// returned by bleve's html highlighter.
+	highlightBefore = "<mark>"
+	highlightAfter  = "</mark>"
+)
+
+// parseFragment converts a fragment returned by bleve's html highlighter into
+// plain text with highlight offsets. The text itself is not escaped by the
+// highlighter, so the markers are only ambiguous if the text contains them
+// verbatim, in which case highlights might be slightly off.
+func parseFragment(s string) *spb.QueryResponse_Fragment {
+	res := &spb.QueryResponse_Fragment{}
+	var text strings.Builder
+	for {
+		before := strings.Index(s, highlightBefore)
+		if before == -1 {
+			break
+		}
+		after := strings.Index(s[before+len(highlightBefore):], highlightAfter)
+		if after == -1 {
+			break
+		}
+		after += before + len(highlightBefore)
+
+		text.WriteString(s[:before])
+		start := text.Len()
+		text.WriteString(s[before+len(highlightBefore) : after])
+		res.Highlights = append(res.Highlights, &spb.QueryResponse_Fragment_Highlight{
+			Start: int64(start),
+			End:   int64(text.Len()),
+		})
+		s = s[after+len(highlightAfter):]
+	}
+	text.WriteString(s)
+	res.Text = text.String()
+	return res
 }
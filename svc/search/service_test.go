@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	spb "github.com/q3k/bugless/proto/svc"
+	"google.golang.org/grpc"
+
+	"github.com/blevesearch/bleve"
+)
+
+// dut returns a service backed by a new in-memory index.
+func dut(t *testing.T) *service {
+	t.Helper()
+	mapping, err := createMapping()
+	if err != nil {
+		t.Fatalf("createMapping: %v", err)
+	}
+	bl, err := bleve.NewMemOnly(mapping)
+	if err != nil {
+		t.Fatalf("NewMemOnly: %v", err)
+	}
+	return &service{
+		bl: bl,
+		id: "test",
+	}
+}
+
+// queryServer collects the responses of a Query call.
+type queryServer struct {
+	grpc.ServerStream
+	res []*spb.QueryResponse
+}
+
+func (q *queryServer) Send(res *spb.QueryResponse) error {
+	q.res = append(q.res, res)
+	return nil
+}
+
+func (q *queryServer) Context() context.Context {
+	return context.Background()
+}
+
+// runQuery runs a Query and returns its responses.
+func runQuery(t *testing.T, s *service, req *spb.QueryRequest) []*spb.QueryResponse {
+	t.Helper()
+	srv := &queryServer{}
+	if err := s.Query(req, srv); err != nil {
+		t.Fatalf("Query(%v): %v", req, err)
+	}
+	return srv.res
+}
+
+func TestQueryPaging(t *testing.T) {
+	ctx := context.Background()
+	s := dut(t)
+
+	// Issues mentioning the query term more often score better, and some
+	// issues score the same, so that both sort keys matter.
+	for i := int64(1); i <= 25; i++ {
+		_, err := s.IndexIssue(ctx, &spb.IndexIssueRequest{
+			Id:    i,
+			Title: fmt.Sprintf("issue %d", i),
+			Comments: []string{
+				strings.Repeat("crash ", int(i%5)+1) + "when starting",
+			},
+		})
+		if err != nil {
+			t.Fatalf("IndexIssue(%d): %v", i, err)
+		}
+	}
+
+	res := runQuery(t, s, &spb.QueryRequest{Query: "crash", PageSize: 10})
+	if want, got := 3, len(res); want != got {
+		t.Fatalf("got %d responses, wanted %d", got, want)
+	}
+	seen := make(map[int64]bool)
+	var all []*spb.QueryResponse_Result
+	for i, r := range res {
+		if want, got := uint64(25), r.TotalHits; want != got {
+			t.Errorf("response %d: total_hits is %d, wanted %d", i, got, want)
+		}
+		if last := i == len(res)-1; last != (r.NextCursor == "") {
+			t.Errorf("response %d: next_cursor is %q", i, r.NextCursor)
+		}
+		for _, result := range r.Results {
+			id := result.GetIssue().Id
+			if seen[id] {
+				t.Errorf("response %d: issue %d returned again", i, id)
+			}
+			seen[id] = true
+			all = append(all, result)
+		}
+	}
+	if want, got := 25, len(all); want != got {
+		t.Fatalf("got %d results, wanted %d", got, want)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Score > all[i-1].Score {
+			t.Errorf("result %d scores %v, better than previous result (%v)", i, all[i].Score, all[i-1].Score)
+		}
+	}
+
+	// Resuming from a cursor returns the same results as the original query
+	// did after it.
+	resumed := runQuery(t, s, &spb.QueryRequest{Query: "crash", PageSize: 10, Cursor: res[0].NextCursor})
+	if want, got := 2, len(resumed); want != got {
+		t.Fatalf("got %d responses after cursor, wanted %d", got, want)
+	}
+	for i, r := range resumed {
+		if want, got := len(res[i+1].Results), len(r.Results); want != got {
+			t.Fatalf("response %d after cursor has %d results, wanted %d", i, got, want)
+		}
+		for j, result := range r.Results {
+			if want, got := res[i+1].Results[j].GetIssue().Id, result.GetIssue().Id; want != got {
+				t.Errorf("result %d of response %d after cursor is issue %d, wanted %d", j, i, got, want)
+			}
+		}
+		if want, got := res[i+1].NextCursor, r.NextCursor; want != got {
+			t.Errorf("response %d after cursor has next_cursor %q, wanted %q", i, got, want)
+		}
+	}
+
+	// An offset skips the same results as a cursor.
+	skipped := runQuery(t, s, &spb.QueryRequest{Query: "crash", PageSize: 10, Offset: 10})
+	if want, got := res[1].Results[0].GetIssue().Id, skipped[0].Results[0].GetIssue().Id; want != got {
+		t.Errorf("first result after offset is issue %d, wanted %d", got, want)
+	}
+
+	srv := &queryServer{}
+	err := s.Query(&spb.QueryRequest{Query: "crash", Offset: 10, Cursor: res[0].NextCursor}, srv)
+	if err == nil {
+		t.Errorf("Query with offset and cursor succeeded")
+	}
+}
+
+func TestCursor(t *testing.T) {
+	for _, offset := range []int{0, 1, 100, 123456} {
+		got, err := decodeCursor(encodeCursor(offset))
+		if err != nil {
+			t.Errorf("decodeCursor(encodeCursor(%d)): %v", offset, err)
+			continue
+		}
+		if got != offset {
+			t.Errorf("decodeCursor(encodeCursor(%d)) is %d", offset, got)
+		}
+	}
+
+	for _, cursor := range []string{
+		"!!!",
+		// "foo"
+		"Zm9v",
+		// "-1"
+		"LTE",
+		// Cursors used to be JSON lists of sort values.
+		"WyIxLjUiLCJpc3N1ZS92MS8xIl0",
+	} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) succeeded", cursor)
+		}
+	}
+}
+
+func TestParseFragment(t *testing.T) {
+	type highlight struct {
+		start, end int64
+	}
+	for _, te := range []struct {
+		fragment   string
+		text       string
+		highlights []highlight
+	}{
+		{"", "", nil},
+		{"no highlights", "no highlights", nil},
+		{"<mark>foo</mark>", "foo", []highlight{{0, 3}}},
+		{"a <mark>foo</mark> b <mark>bar</mark>", "a foo b bar", []highlight{{2, 5}, {8, 11}}},
+		{"…the <mark>crash</mark>…", "…the crash…", []highlight{{7, 12}}},
+		// Unterminated markers are left as they are.
+		{"a <mark>foo", "a <mark>foo", nil},
+		{"<mark>foo</mark> <mark>bar", "foo <mark>bar", []highlight{{0, 3}}},
+		{"foo</mark>", "foo</mark>", nil},
+	} {
+		res := parseFragment(te.fragment)
+		if res.Text != te.text {
+			t.Errorf("parseFragment(%q) text is %q, wanted %q", te.fragment, res.Text, te.text)
+		}
+		var got []highlight
+		for _, h := range res.Highlights {
+			got = append(got, highlight{h.Start, h.End})
+		}
+		if fmt.Sprint(got) != fmt.Sprint(te.highlights) {
+			t.Errorf("parseFragment(%q) highlights are %v, wanted %v", te.fragment, got, te.highlights)
+		}
+	}
+}
+
+func TestQueryFragments(t *testing.T) {
+	ctx := context.Background()
+	s := dut(t)
+
+	_, err := s.IndexIssue(ctx, &spb.IndexIssueRequest{
+		Id:       1,
+		Title:    "Crash on startup",
+		Comments: []string{"The server crashes when starting."},
+	})
+	if err != nil {
+		t.Fatalf("IndexIssue: %v", err)
+	}
+
+	res := runQuery(t, s, &spb.QueryRequest{Query: "title:crash"})
+	if len(res) != 1 || len(res[0].Results) != 1 {
+		t.Fatalf("got %v, wanted a single result", res)
+	}
+	fs := res[0].Results[0].FragmentsByField["title"]
+	if fs == nil || len(fs.Fragments) != 1 {
+		t.Fatalf("got title fragments %v, wanted one", fs)
+	}
+	f := fs.Fragments[0]
+	if want, got := "Crash on startup", f.Text; want != got {
+		t.Errorf("fragment text is %q, wanted %q", got, want)
+	}
+	if len(f.Highlights) != 1 || f.Text[f.Highlights[0].Start:f.Highlights[0].End] != "Crash" {
+		t.Errorf("fragment highlights are %v, wanted \"Crash\"", f.Highlights)
+	}
+}
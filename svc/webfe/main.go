@@ -171,6 +171,7 @@ func main() {
 
 	mux.HandleFunc("/", fe.viewRoot)
 	mux.HandleFunc("/issues", fe.viewIssues)
+	mux.HandleFunc("/issues/new", fe.viewNewIssue)
 	mux.HandleFunc("/login", fe.viewLogin)
 	mux.HandleFunc("/login/oauth-redirect", fe.viewLoginOAuthRedirect)
 	mux.HandleFunc("/logout", fe.viewLogout)
@@ -55,6 +55,38 @@ func (b *backendProxy) GetIssueUpdates(req *pb.ModelGetIssueUpdatesRequest, srv
 	return nil
 }
 
+func (b *backendProxy) CountIssues(ctx context.Context, req *pb.ModelCountIssuesRequest) (*pb.ModelCountIssuesResponse, error) {
+	return b.model.CountIssues(ctx, req)
+}
+
+func (b *backendProxy) CompleteQuery(ctx context.Context, req *pb.ModelCompleteQueryRequest) (*pb.ModelCompleteQueryResponse, error) {
+	return b.model.CompleteQuery(ctx, req)
+}
+
+func (b *backendProxy) SuggestDuplicates(ctx context.Context, req *pb.ModelSuggestDuplicatesRequest) (*pb.ModelSuggestDuplicatesResponse, error) {
+	return b.model.SuggestDuplicates(ctx, req)
+}
+
+func (b *backendProxy) WatchChanges(req *pb.ModelWatchChangesRequest, srv pb.Model_WatchChangesServer) error {
+	upstream, err := b.model.WatchChanges(srv.Context(), req)
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := upstream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := srv.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (b *backendProxy) NewIssue(ctx context.Context, req *pb.ModelNewIssueRequest) (*pb.ModelNewIssueResponse, error) {
 	return b.model.NewIssue(ctx, req)
 }
@@ -62,3 +94,31 @@ func (b *backendProxy) NewIssue(ctx context.Context, req *pb.ModelNewIssueReques
 func (b *backendProxy) UpdateIssue(ctx context.Context, req *pb.ModelUpdateIssueRequest) (*pb.ModelUpdateIssueResponse, error) {
 	return b.model.UpdateIssue(ctx, req)
 }
+
+func (b *backendProxy) GetCategoryTree(ctx context.Context, req *pb.ModelGetCategoryTreeRequest) (*pb.ModelGetCategoryTreeResponse, error) {
+	return b.model.GetCategoryTree(ctx, req)
+}
+
+func (b *backendProxy) NewCategory(ctx context.Context, req *pb.ModelNewCategoryRequest) (*pb.ModelNewCategoryResponse, error) {
+	return b.model.NewCategory(ctx, req)
+}
+
+func (b *backendProxy) UpdateCategory(ctx context.Context, req *pb.ModelUpdateCategoryRequest) (*pb.ModelUpdateCategoryResponse, error) {
+	return b.model.UpdateCategory(ctx, req)
+}
+
+func (b *backendProxy) DeleteCategory(ctx context.Context, req *pb.ModelDeleteCategoryRequest) (*pb.ModelDeleteCategoryResponse, error) {
+	return b.model.DeleteCategory(ctx, req)
+}
+
+func (b *backendProxy) NewUser(ctx context.Context, req *pb.ModelNewUserRequest) (*pb.ModelNewUserResponse, error) {
+	return b.model.NewUser(ctx, req)
+}
+
+func (b *backendProxy) GetUsers(ctx context.Context, req *pb.ModelGetUsersRequest) (*pb.ModelGetUsersResponse, error) {
+	return b.model.GetUsers(ctx, req)
+}
+
+func (b *backendProxy) UpdateUser(ctx context.Context, req *pb.ModelUpdateUserRequest) (*pb.ModelUpdateUserResponse, error) {
+	return b.model.UpdateUser(ctx, req)
+}
@@ -8,11 +8,21 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	pb "github.com/q3k/bugless/proto/svc"
 )
 
+// issuesPerPage is the amount of issues shown on a single page of results.
+const issuesPerPage = 50
+
+// issuesPageURL returns the URL of a page of results for a query, given its
+// page token.
+func issuesPageURL(q, token string) string {
+	return fmt.Sprintf("/issues?q=%s&page=%s", url.QueryEscape(q), url.QueryEscape(token))
+}
+
 func (f *httpFrontend) viewIssues(w http.ResponseWriter, r *http.Request) {
 	session := f.getSession(w, r)
 	f.l.Info("session", "session", session)
@@ -31,10 +41,16 @@ func (f *httpFrontend) viewIssues(w http.ResponseWriter, r *http.Request) {
 			},
 		},
 		OrderBy: pb.ModelGetIssuesRequest_ORDER_BY_LAST_UPDATE,
+		Pagination: &pb.PaginationSelector{
+			After: r.URL.Query().Get("page"),
+			Count: issuesPerPage,
+		},
 	})
 
 	var issues []map[string]interface{}
-	var queryErrors []string
+	var prevPage, nextPage string
+	first := true
+	var queryErrors []map[string]interface{}
 	var issuesGetErr error
 	if err != nil {
 		issuesGetErr = err
@@ -50,8 +66,16 @@ func (f *httpFrontend) viewIssues(w http.ResponseWriter, r *http.Request) {
 				issuesGetErr = err
 				break
 			}
-			if chunk.QueryErrors != nil {
-				queryErrors = append(queryErrors, chunk.QueryErrors...)
+			for _, e := range chunk.QueryErrors {
+				queryErrors = append(queryErrors, queryErrorSoy(q, e))
+			}
+			if first && chunk.PrevPageToken != "" {
+				prevPage = issuesPageURL(q, chunk.PrevPageToken)
+			}
+			first = false
+			nextPage = ""
+			if chunk.NextPageToken != "" {
+				nextPage = issuesPageURL(q, chunk.NextPageToken)
 			}
 			for _, issue := range chunk.Issues {
 				issues = append(issues, map[string]interface{}{
@@ -62,6 +86,7 @@ func (f *httpFrontend) viewIssues(w http.ResponseWriter, r *http.Request) {
 					"assignee":     issue.Current.Assignee.Id,
 					"status":       issueStatusPretty(issue.Current.Status),
 					"last_updated": time.Unix(0, issue.LastUpdated.Nanos).Format("Jan 2, 2006 15:04:05"),
+					"snippets":     fragmentsSoy(chunk.Snippets[issue.Id]),
 				})
 			}
 		}
@@ -72,12 +97,32 @@ func (f *httpFrontend) viewIssues(w http.ResponseWriter, r *http.Request) {
 		f.l.Error("could not get issues", "err", issuesGetErr)
 	}
 
+	// Show the total amount of matching issues and their statuses, falling
+	// back to the amount of issues on this page if counting fails.
+	total := fmt.Sprintf("%d", len(issues))
+	var statuses string
+	if issuesGetErr == nil {
+		counts, err := f.model.CountIssues(r.Context(), &pb.ModelCountIssuesRequest{
+			Search: q,
+		})
+		if err != nil {
+			f.l.Error("could not count issues", "err", err)
+		} else {
+			total = fmt.Sprintf("%d", counts.Total)
+			statuses = statusCountsPretty(counts.Statuses)
+		}
+	}
+
 	err = f.tofu.Render(w, "bugless.templates.base.html", map[string]interface{}{
 		"title":       "Bugless - Home",
 		"lvr":         f.lvr,
 		"query":       q,
 		"queryErrors": queryErrors,
 		"issues":      issues,
+		"total":       total,
+		"statuses":    statuses,
+		"prevPage":    prevPage,
+		"nextPage":    nextPage,
 		"session":     session.soy(),
 		"paths": map[string]string{
 			"js":  f.paths.js,
@@ -90,3 +135,68 @@ func (f *httpFrontend) viewIssues(w http.ResponseWriter, r *http.Request) {
 	f.l.Crit("could not render template", "err", err)
 	fmt.Fprintf(w, "something went wrong.")
 }
+
+// statusCountsPretty summarizes status counts, eg. "80 New, 40 Assigned".
+func statusCountsPretty(counts []*pb.ModelCountIssuesResponse_StatusCount) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%d %s", c.Count, issueStatusPretty(c.Status))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fragmentsSoy converts search result fragments into template lists of parts,
+// each either highlighted or not.
+func fragmentsSoy(fs *pb.QueryResponse_Fragments) []interface{} {
+	res := []interface{}{}
+	for _, f := range fs.GetFragments() {
+		parts := []map[string]interface{}{}
+		add := func(text string, match bool) {
+			if text != "" {
+				parts = append(parts, map[string]interface{}{"text": text, "match": match})
+			}
+		}
+		pos := 0
+		for _, h := range f.Highlights {
+			start, end := int(h.Start), int(h.End)
+			if start < pos || end < start || end > len(f.Text) {
+				continue
+			}
+			add(f.Text[pos:start], false)
+			add(f.Text[start:end], true)
+			pos = end
+		}
+		add(f.Text[pos:], false)
+		res = append(res, parts)
+	}
+	return res
+}
+
+// queryErrorSoy converts a query error into a template record, with the query
+// split around the offending part so that it can be underlined.
+func queryErrorSoy(q string, e *pb.QueryError) map[string]interface{} {
+	clamp := func(i int64) int {
+		if i < 0 {
+			return 0
+		}
+		if i > int64(len(q)) {
+			return len(q)
+		}
+		return int(i)
+	}
+	start, end := clamp(e.Start), clamp(e.End)
+	if end < start {
+		end = start
+	}
+	severity := "Error"
+	if e.Severity == pb.QueryError_SEVERITY_WARNING {
+		severity = "Warning"
+	}
+	return map[string]interface{}{
+		"severity": severity,
+		"message":  e.Message,
+		"before":   q[:start],
+		"part":     q[start:end],
+		"after":    q[end:],
+	}
+}
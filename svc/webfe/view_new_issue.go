@@ -0,0 +1,170 @@
+// Copyright 2020 Sergiusz Bazanski <q3k@q3k.org>
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cpb "github.com/q3k/bugless/proto/common"
+	pb "github.com/q3k/bugless/proto/svc"
+
+	"google.golang.org/grpc/status"
+)
+
+// newIssueTypes are the issue types that can be picked when filing an issue,
+// in order of appearance.
+var newIssueTypes = []cpb.IssueType{
+	cpb.IssueType_BUG,
+	cpb.IssueType_FEATURE_REQUEST,
+	cpb.IssueType_CUSTOMER_ISSUE,
+	cpb.IssueType_INTERNAL_CLEANUP,
+	cpb.IssueType_PROCESS,
+	cpb.IssueType_VULNERABILITY,
+}
+
+// newIssueDuplicates is the maximum amount of possible duplicates shown
+// before filing an issue.
+const newIssueDuplicates = 5
+
+// csrfToken returns the anti-CSRF token of a session, which must be submitted
+// alongside forms that change data.
+func (f *httpFrontend) csrfToken(s *session) string {
+	mac := hmac.New(sha256.New, f.secretKey)
+	mac.Write([]byte("csrf\n" + s.accessToken))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// viewNewIssue serves the form to file a new issue. Before an issue is filed,
+// the user is shown open issues similar to it (if any), and has to confirm
+// that it's not a duplicate of any of them.
+func (f *httpFrontend) viewNewIssue(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	session := f.getSession(w, r)
+	if session == nil {
+		http.Redirect(w, r, "/login", 302)
+		return
+	}
+
+	draft := map[string]interface{}{
+		"title":    "",
+		"body":     "",
+		"type":     cpb.IssueType_BUG.String(),
+		"priority": "2",
+		"csrf":     f.csrfToken(session),
+	}
+	var formError string
+	duplicates := []interface{}{}
+
+	if r.Method == "POST" {
+		if !hmac.Equal([]byte(r.FormValue("csrf")), []byte(f.csrfToken(session))) {
+			w.WriteHeader(403)
+			fmt.Fprintf(w, "Invalid form submission. Please go back and try again.")
+			return
+		}
+
+		title := strings.TrimSpace(r.FormValue("title"))
+		body := strings.TrimSpace(r.FormValue("body"))
+		typ := cpb.IssueType(cpb.IssueType_value[r.FormValue("type")])
+		priority, priorityErr := strconv.ParseInt(r.FormValue("priority"), 10, 64)
+		draft["title"] = title
+		draft["body"] = body
+		draft["type"] = typ.String()
+		draft["priority"] = r.FormValue("priority")
+
+		switch {
+		case title == "":
+			formError = "title must be set"
+		case typ == cpb.IssueType_ISSUE_TYPE_INVALID:
+			formError = "type must be set"
+		case priorityErr != nil:
+			formError = "priority must be set"
+		default:
+			if r.FormValue("confirmed") == "" {
+				duplicates = f.duplicatesSoy(ctx, title, body)
+			}
+			if len(duplicates) > 0 {
+				break
+			}
+			res, err := f.model.NewIssue(ctx, &pb.ModelNewIssueRequest{
+				Author: &cpb.User{Username: session.username},
+				InitialState: &cpb.IssueState{
+					Title:    title,
+					Type:     typ,
+					Priority: priority,
+					Status:   cpb.IssueStatus_NEW,
+				},
+				InitialComment: body,
+			})
+			if err != nil {
+				f.l.Error("could not file issue", "err", err)
+				formError = "could not file issue: " + status.Convert(err).Message()
+				break
+			}
+			http.Redirect(w, r, fmt.Sprintf("/issues?q=id:%d", res.Id), 302)
+			return
+		}
+	}
+
+	var types []map[string]interface{}
+	for _, t := range newIssueTypes {
+		types = append(types, map[string]interface{}{
+			"value": t.String(),
+			"name":  issueTypePretty(t),
+		})
+	}
+
+	err := f.tofu.Render(w, "bugless.templates.newissue.html", map[string]interface{}{
+		"title":      "Bugless - New issue",
+		"lvr":        f.lvr,
+		"session":    session.soy(),
+		"draft":      draft,
+		"types":      types,
+		"priorities": []string{"0", "1", "2", "3", "4"},
+		"error":      formError,
+		"duplicates": duplicates,
+		"paths": map[string]string{
+			"js":  f.paths.js,
+			"css": f.paths.css,
+		},
+	})
+	if err == nil {
+		return
+	}
+	f.l.Crit("could not render template", "err", err)
+	fmt.Fprintf(w, "something went wrong.")
+}
+
+// duplicatesSoy returns template records of open issues similar to a draft
+// issue. Failing to find any is not fatal, as it should not prevent filing
+// issues.
+func (f *httpFrontend) duplicatesSoy(ctx context.Context, title, body string) []interface{} {
+	res := []interface{}{}
+	suggestions, err := f.model.SuggestDuplicates(ctx, &pb.ModelSuggestDuplicatesRequest{
+		Title: title,
+		Body:  body,
+		Limit: newIssueDuplicates,
+	})
+	if err != nil {
+		f.l.Error("could not suggest duplicates", "err", err)
+		return res
+	}
+	for _, s := range suggestions.Suggestions {
+		issue := s.Issue
+		res = append(res, map[string]interface{}{
+			"priority": fmt.Sprintf("%d", issue.Current.Priority),
+			"id":       fmt.Sprintf("%d", issue.Id),
+			"type":     issueTypePretty(issue.Current.Type),
+			"title":    issue.Current.Title,
+			"status":   issueStatusPretty(issue.Current.Status),
+		})
+	}
+	return res
+}